@@ -12,31 +12,56 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	omniconstants "github.com/siderolabs/omni/client/pkg/constants"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/ip"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/ipxe"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/meta"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/provider"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/telemetry"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/version"
 )
 
 const apiHostFlag = "api-host"
 
 var rootCmdArgs struct {
-	apiHost             string
-	omniAPIEndpoint     string
-	imageFactoryPXEURL  string
-	providerName        string
-	providerDescription string
+	apiHosts               []string
+	omniAPIEndpoint        string
+	imageFactoryPXEURL     string
+	imageFactoryBaseURL    string
+	ipxeBootMode           string
+	ipxeLocalAssetsDir     string
+	agentTalosVersion      string
+	otelEndpoint           string
+	otelProtocol           string
+	otelServiceName        string
+	adminToken             string
+	providerName           string
+	providerDescription    string
+	auditLogDir            string
+	bmcCredentialsDir      string
+	httpBootSigningKeyFile string
+	ipmiRotateSecretDir    string
+	ipmiRotateKeyFile      string
+	tlsCertFile            string
+	tlsKeyFile             string
+	tlsClientCAsFile       string
 
 	ipxeServerPort int
 	apiPort        int
+	grpcPort       int
+
+	ipmiRotateInterval time.Duration
+	ipmiRotateJitter   time.Duration
 
 	insecureSkipTLSVerify bool
 	debug                 bool
+	ipmiRotateDryRun      bool
 }
 
 // rootCmd represents the base command when called without any subcommands.
@@ -76,26 +101,31 @@ func initLogger() (*zap.Logger, error) {
 }
 
 func run(ctx context.Context, logger *zap.Logger) error {
-	apiHost := rootCmdArgs.apiHost
+	apiHosts := rootCmdArgs.apiHosts
 
-	if apiHost == "" {
+	if len(apiHosts) == 0 {
 		routableIPs, err := ip.RoutableIPs()
 		if err != nil {
 			return fmt.Errorf("failed to get routable IPs: %w", err)
 		}
 
-		if len(routableIPs) != 1 {
-			return fmt.Errorf(`expected exactly one routable IP, got %d: %v. specify "--%s" flag explicitly`, len(routableIPs), routableIPs, apiHostFlag)
+		if len(routableIPs) == 0 {
+			return fmt.Errorf(`no routable IP found, specify "--%s" explicitly`, apiHostFlag)
 		}
 
-		apiHost = routableIPs[0]
+		apiHosts = routableIPs
 	}
 
-	logger.Info("starting server", zap.String("api_host", apiHost), zap.Int("port", rootCmdArgs.apiPort))
+	logger.Info("starting server", zap.Strings("api_hosts", apiHosts), zap.Int("port", rootCmdArgs.apiPort))
 
 	prov := provider.New(
-		rootCmdArgs.providerName, rootCmdArgs.providerDescription, rootCmdArgs.omniAPIEndpoint, rootCmdArgs.imageFactoryPXEURL, rootCmdArgs.ipxeServerPort,
-		apiHost, rootCmdArgs.apiPort, rootCmdArgs.insecureSkipTLSVerify, logger)
+		rootCmdArgs.providerName, rootCmdArgs.providerDescription, rootCmdArgs.omniAPIEndpoint, rootCmdArgs.imageFactoryPXEURL, rootCmdArgs.imageFactoryBaseURL,
+		rootCmdArgs.ipxeBootMode, rootCmdArgs.ipxeLocalAssetsDir, rootCmdArgs.agentTalosVersion,
+		rootCmdArgs.otelEndpoint, rootCmdArgs.otelProtocol, rootCmdArgs.otelServiceName, rootCmdArgs.adminToken,
+		rootCmdArgs.ipmiRotateInterval, rootCmdArgs.ipmiRotateJitter, rootCmdArgs.ipmiRotateDryRun, rootCmdArgs.ipmiRotateSecretDir, rootCmdArgs.ipmiRotateKeyFile,
+		rootCmdArgs.ipxeServerPort,
+		apiHosts, rootCmdArgs.apiPort, rootCmdArgs.insecureSkipTLSVerify, rootCmdArgs.auditLogDir, rootCmdArgs.bmcCredentialsDir, rootCmdArgs.httpBootSigningKeyFile,
+		rootCmdArgs.tlsCertFile, rootCmdArgs.tlsKeyFile, rootCmdArgs.tlsClientCAsFile, rootCmdArgs.grpcPort, logger)
 
 	if err := prov.Run(ctx); err != nil {
 		return fmt.Errorf("failed to run provider: %w", err)
@@ -118,14 +148,33 @@ func runCmd() error {
 }
 
 func init() {
-	rootCmd.Flags().StringVar(&rootCmdArgs.apiHost, apiHostFlag, "",
-		"The IP address to bind on and advertise. Required if the server has more than a single routable IP address. If not specified, the single routable IP address will be used.")
+	rootCmd.Flags().StringArrayVar(&rootCmdArgs.apiHosts, apiHostFlag, nil,
+		"An IP address to bind on and advertise. Repeat to bind on several interfaces at once, e.g. a management IPv4 address and a provisioning IPv6 address. "+
+			"If not specified, every routable IP address on the host is used.")
 	rootCmd.Flags().IntVar(&rootCmdArgs.apiPort, "api-port", 50042, "The port to run the api server on.")
 	rootCmd.Flags().StringVar(&rootCmdArgs.omniAPIEndpoint, "omni-api-endpoint", os.Getenv("OMNI_ENDPOINT"),
 		"The endpoint of the Omni API, if not set, defaults to OMNI_ENDPOINT env var.")
 	rootCmd.Flags().StringVar(&meta.ProviderID, "id", meta.ProviderID, "The id of the infra provider, it is used to match the resources with the infra provider label.")
-	rootCmd.Flags().StringVar(&rootCmdArgs.imageFactoryPXEURL, "image-factory-pxe-url", "https://pxe.factory.talos.dev", "The URL of the image factory PXE server.")
+	rootCmd.Flags().StringVar(&rootCmdArgs.imageFactoryPXEURL, "image-factory-pxe-url", "https://pxe.factory.talos.dev", "The URL of the image factory PXE server, used to build the iPXE chain URL.")
+	rootCmd.Flags().StringVar(&rootCmdArgs.imageFactoryBaseURL, "image-factory-base-url", "https://factory.talos.dev", "The URL of the image factory HTTP API, used to register the agent schematic.")
 	rootCmd.Flags().IntVar(&rootCmdArgs.ipxeServerPort, "ipxe-server-port", 50043, "The port the local (chaining) iPXE server should run on.")
+	rootCmd.Flags().StringVar(&rootCmdArgs.ipxeBootMode, "ipxe-boot-mode", string(ipxe.ModeChaining),
+		fmt.Sprintf("How machines are booted into the agent: %q chains to the image factory, %q serves the kernel/initramfs from --ipxe-local-assets-dir.",
+			ipxe.ModeChaining, ipxe.ModeLocal))
+	rootCmd.Flags().StringVar(&rootCmdArgs.ipxeLocalAssetsDir, "ipxe-local-assets-dir", "",
+		fmt.Sprintf("Directory containing the agent \"vmlinuz\"/\"initramfs\" to serve in %q boot mode. Required in that mode.", ipxe.ModeLocal))
+	rootCmd.Flags().StringVar(&rootCmdArgs.agentTalosVersion, "agent-talos-version", omniconstants.DefaultTalosVersion,
+		fmt.Sprintf("The Talos version of the agent image requested from the image factory in %q boot mode.", ipxe.ModeChaining))
+
+	rootCmd.Flags().StringVar(&rootCmdArgs.otelEndpoint, "otel-endpoint", "",
+		"The \"host:port\" of an OTLP collector to export traces and metrics to. If not set, OpenTelemetry export is disabled.")
+	rootCmd.Flags().StringVar(&rootCmdArgs.otelProtocol, "otel-protocol", string(telemetry.ProtocolGRPC),
+		fmt.Sprintf("The OTLP protocol to use to reach --otel-endpoint: %q or %q.", telemetry.ProtocolGRPC, telemetry.ProtocolHTTP))
+	rootCmd.Flags().StringVar(&rootCmdArgs.otelServiceName, "otel-service-name", version.Name,
+		"The \"service.name\" resource attribute reported on every trace and metric exported to --otel-endpoint.")
+
+	rootCmd.Flags().StringVar(&rootCmdArgs.adminToken, "admin-token", os.Getenv("ADMIN_TOKEN"),
+		"Bearer token required to call the admin API, mounted at \"/admin/\" on --api-port. If not set (and ADMIN_TOKEN env var is unset), the admin API is disabled.")
 
 	rootCmd.Flags().StringVar(&rootCmdArgs.providerName, "provider-name", "Bare Metal", "Provider name as it appears in Omni")
 	rootCmd.Flags().StringVar(&rootCmdArgs.providerDescription, "provider-description", "Bare metal infrastructure provider", "Provider description as it appears in Omni")
@@ -134,4 +183,27 @@ func init() {
 
 	rootCmd.Flags().BoolVar(&rootCmdArgs.insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Skip TLS verification when connecting to the Omni API.")
 	rootCmd.Flags().BoolVar(&rootCmdArgs.debug, "debug", false, "Enable debug mode & logs.")
+	rootCmd.Flags().StringVar(&rootCmdArgs.auditLogDir, "audit-log-dir", "", "Directory to write the audit log to. If not set, audit logging is disabled.")
+	rootCmd.Flags().StringVar(&rootCmdArgs.bmcCredentialsDir, "bmc-credentials-dir", "",
+		"Directory containing shared BMC credentials (\"username\" and \"password\" files) to use for all machines, overriding the per-machine credentials. If not set, per-machine credentials are used.")
+	rootCmd.Flags().StringVar(&rootCmdArgs.httpBootSigningKeyFile, "http-boot-signing-key-file", "",
+		"File containing the secret used to sign UEFI HTTP Boot URLs handed out in DHCP offers. If not set, HTTP boot artifacts are served unauthenticated.")
+
+	rootCmd.Flags().StringVar(&rootCmdArgs.tlsCertFile, "tls-cert-file", "",
+		"Certificate file to terminate TLS on the server itself, instead of relying on an ingress/load balancer to do so. If not set, TLS termination is disabled.")
+	rootCmd.Flags().StringVar(&rootCmdArgs.tlsKeyFile, "tls-key-file", "", "Key file matching --tls-cert-file. Required if --tls-cert-file is set.")
+	rootCmd.Flags().StringVar(&rootCmdArgs.tlsClientCAsFile, "tls-client-ca-file", "",
+		"PEM bundle of CA certificates to verify client certificates against (mTLS). Only used if --tls-cert-file is set; if not set, client certificates aren't required.")
+	rootCmd.Flags().IntVar(&rootCmdArgs.grpcPort, "grpc-port", 0,
+		"Bind the GRPC server on its own port instead of multiplexing it with the HTTP server over h2c. If not set, GRPC is multiplexed onto --api-port.")
+
+	rootCmd.Flags().DurationVar(&rootCmdArgs.ipmiRotateInterval, "ipmi-rotate-interval", 0,
+		"How often to sweep the fleet and rotate IPMI credentials. If not set, periodic IPMI credential rotation is disabled.")
+	rootCmd.Flags().DurationVar(&rootCmdArgs.ipmiRotateJitter, "ipmi-rotate-jitter", time.Minute,
+		"Upper bound of a random per-machine delay added before each rotation, so a large fleet doesn't hit every machine's agent and Omni at once.")
+	rootCmd.Flags().BoolVar(&rootCmdArgs.ipmiRotateDryRun, "ipmi-rotate-dry-run", false, "Log the IPMI credential rotations that would happen instead of performing them.")
+	rootCmd.Flags().StringVar(&rootCmdArgs.ipmiRotateSecretDir, "ipmi-rotate-secret-dir", "",
+		"Directory to persist rotated IPMI passwords to, encrypted with --ipmi-rotate-key-file. Required if --ipmi-rotate-interval is set.")
+	rootCmd.Flags().StringVar(&rootCmdArgs.ipmiRotateKeyFile, "ipmi-rotate-key-file", "",
+		"File containing the AES key (16, 24 or 32 bytes) used to encrypt rotated IPMI passwords written to --ipmi-rotate-secret-dir. Required if --ipmi-rotate-interval is set.")
 }
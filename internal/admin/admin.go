@@ -0,0 +1,256 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package admin implements a bearer-token-authenticated HTTP API for operators to inspect and
+// control bare-metal servers out of band from Omni, e.g. for scripting against host lifecycle
+// events that aren't yet exposed as Omni resources.
+package admin
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/siderolabs/omni-infra-provider-bare-metal/api/specs"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/agent"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/audit"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/power"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/resources"
+)
+
+// ipmiUsername is the IPMI username the admin API requests when rotating credentials, matching
+// the one service.ProviderServiceServer requests during provisioning.
+const ipmiUsername = "talos-agent"
+
+// actor identifies the admin API as the audit.Record actor for actions it triggers, so they can
+// be told apart from the same actions triggered by Omni.
+const actor = "admin_api"
+
+// AgentController is the interface to send commands to the Talos metal agent.
+type AgentController interface {
+	ListConnectedServers() []agent.ConnectedServer
+	SetIPMICredentials(ctx context.Context, id, username string) (string, error)
+}
+
+// OmniClient is the interface to read and persist resources.Machine resources.
+type OmniClient interface {
+	GetMachine(ctx context.Context, id string) (*resources.Machine, error)
+	SaveMachine(ctx context.Context, id string, spec *specs.MachineSpec) (*resources.Machine, error)
+}
+
+// Handler serves the admin HTTP API.
+type Handler struct {
+	logger          *zap.Logger
+	agentController AgentController
+	omniClient      OmniClient
+	bmcCredentials  power.Credentials
+	token           string
+
+	mux *http.ServeMux
+}
+
+// NewHandler creates a new Handler, authenticating every request against token.
+func NewHandler(token string, agentController AgentController, omniClient OmniClient, bmcCredentials power.Credentials, logger *zap.Logger) *Handler {
+	h := &Handler{
+		logger:          logger,
+		agentController: agentController,
+		omniClient:      omniClient,
+		bmcCredentials:  bmcCredentials,
+		token:           token,
+	}
+
+	// There is deliberately no "mark installed" route: flipping a machine's installed/fresh status
+	// requires persisting that bit on resources.Machine, and specs.MachineSpec doesn't carry a
+	// field for it yet - see the similar todo on resources.BMCSpec. Add the route once it does,
+	// rather than serving an endpoint that can't do anything real.
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/servers", h.listServers)
+	mux.HandleFunc("POST /admin/host/{id}/reboot", h.reboot)
+	mux.HandleFunc("POST /admin/host/{id}/rotate-ipmi-credentials", h.rotateIPMICredentials)
+
+	h.mux = mux
+
+	return h
+}
+
+// ServeHTTP authenticates the request against the bearer token, then dispatches it.
+//
+// Implements http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !h.authorized(req) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	h.mux.ServeHTTP(w, req)
+}
+
+// authorized reports whether req carries a valid "Authorization: Bearer <token>" header.
+func (h *Handler) authorized(req *http.Request) bool {
+	const prefix = "Bearer "
+
+	authHeader := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, prefix) {
+		return false
+	}
+
+	given := strings.TrimPrefix(authHeader, prefix)
+
+	return len(given) == len(h.token) && hmac.Equal([]byte(given), []byte(h.token))
+}
+
+// listServers lists the servers currently connected to the provider over a reverse tunnel.
+func (h *Handler) listServers(w http.ResponseWriter, req *http.Request) {
+	servers := h.agentController.ListConnectedServers()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(servers); err != nil {
+		h.logger.Error("failed to encode connected servers", zap.Error(err))
+	}
+}
+
+// reboot sets a one-shot PXE boot-device override on the server with the given ID and force
+// power-cycles it via its BMC, so it comes back up chaining into the agent rather than the
+// installed OS.
+//
+// This goes through the BMC rather than the agent tunnel: the upstream talos-metal-agent
+// AgentService only exposes SetIPMICredentials/GetIPMIInfo today, with no reboot or boot-device
+// RPC to tunnel through, so a BMC-driven PXE cycle is the only way to achieve this.
+func (h *Handler) reboot(w http.ResponseWriter, req *http.Request) {
+	ctx := audit.WithActor(req.Context(), actor)
+	id := req.PathValue("id")
+
+	powerManager, err := h.powerManagerFor(ctx, id)
+	if err != nil {
+		h.logger.Error("failed to build power manager", zap.String("machine_id", id), zap.Error(err))
+		http.Error(w, "failed to reach machine BMC", http.StatusInternalServerError)
+
+		return
+	}
+
+	err = powerManager.SetBootDevice(ctx, power.BootDevicePXE)
+
+	audit.Write(ctx, audit.ActionBootDeviceOverride, id, audit.ResultFromErr(err), "", string(power.BootDevicePXE), err)
+
+	if err != nil {
+		h.logger.Error("failed to set PXE boot-device override", zap.String("machine_id", id), zap.Error(err))
+		http.Error(w, "failed to set PXE boot-device override", http.StatusInternalServerError)
+
+		return
+	}
+
+	err = powerManager.Cycle(ctx)
+
+	audit.Write(ctx, audit.ActionPowerCycle, id, audit.ResultFromErr(err), "", "", err)
+
+	if err != nil {
+		h.logger.Error("failed to power cycle machine", zap.String("machine_id", id), zap.Error(err))
+		http.Error(w, "failed to reboot machine", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rotateIPMICredentials sets a new IPMI password on the server with the given ID and persists it
+// to Omni, out-of-band from the initial-provisioning rotation in service.ProviderServiceServer.
+func (h *Handler) rotateIPMICredentials(w http.ResponseWriter, req *http.Request) {
+	ctx := audit.WithActor(req.Context(), actor)
+	id := req.PathValue("id")
+
+	machine, err := h.omniClient.GetMachine(ctx, id)
+	if err != nil {
+		h.logger.Error("failed to get machine", zap.String("machine_id", id), zap.Error(err))
+		http.Error(w, "failed to get machine", http.StatusInternalServerError)
+
+		return
+	}
+
+	password, err := h.agentController.SetIPMICredentials(ctx, id, ipmiUsername)
+
+	// The password itself must never be written to the audit trail in plaintext - only a
+	// fingerprint, so operators can still correlate records without it becoming a secrets leak.
+	var fingerprint string
+	if err == nil {
+		fingerprint = audit.Fingerprint(password)
+	}
+
+	audit.Write(ctx, audit.ActionIPMICredentials, id, audit.ResultFromErr(err), "", fingerprint, err)
+
+	if err != nil {
+		h.logger.Error("failed to rotate IPMI credentials", zap.String("machine_id", id), zap.Error(err))
+		http.Error(w, "failed to rotate IPMI credentials", http.StatusInternalServerError)
+
+		return
+	}
+
+	spec := machine.TypedSpec().Value
+
+	// Persist the rotated password the same way ipmirotate.Rotator does, so the next power
+	// operation against this machine - including this API's own /reboot, which reads
+	// MachineSpec.IpmiPassword via powerManagerFor - authenticates with the new password instead
+	// of the one Omni still has on file.
+	if _, err = h.omniClient.SaveMachine(ctx, id, &specs.MachineSpec{
+		IpmiIp:       spec.IpmiIp,
+		IpmiPort:     spec.IpmiPort,
+		IpmiPassword: password,
+	}); err != nil {
+		h.logger.Error("failed to save rotated IPMI credentials to Omni", zap.String("machine_id", id), zap.Error(err))
+		http.Error(w, "failed to save rotated IPMI credentials", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err = json.NewEncoder(w).Encode(struct {
+		Password string `json:"password"`
+	}{Password: password}); err != nil {
+		h.logger.Error("failed to encode rotated credentials", zap.String("machine_id", id), zap.Error(err))
+	}
+}
+
+// powerManagerFor builds the power.Manager for the machine's BMC, the same way
+// service.ProviderServiceServer.powerManagerFor does, including probing which protocol it speaks.
+func (h *Handler) powerManagerFor(ctx context.Context, id string) (power.Manager, error) {
+	machine, err := h.omniClient.GetMachine(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get machine: %w", err)
+	}
+
+	bmcSpec := resources.BMCSpecFromMachine(machine)
+
+	driver := power.ProbeDriver(ctx, bmcSpec.Address, bmcSpec.VerifyTLS)
+
+	h.logger.Info("probed BMC protocol", zap.String("machine_id", id), zap.String("driver", string(driver)))
+
+	address := bmcSpec.Address
+	if driver == power.DriverRedfish {
+		address = "https://" + bmcSpec.Address
+	}
+
+	username := ipmiUsername
+	password := machine.TypedSpec().Value.IpmiPassword
+
+	if h.bmcCredentials.Username != "" {
+		username = h.bmcCredentials.Username
+		password = h.bmcCredentials.Password
+	}
+
+	return power.New(power.Config{
+		Driver:   driver,
+		Address:  address,
+		Port:     bmcSpec.Port,
+		Username: username,
+		Password: password,
+	})
+}
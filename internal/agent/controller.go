@@ -13,6 +13,7 @@ import (
 	agentpb "github.com/siderolabs/talos-metal-agent/api/agent"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
 )
 
 // Controller controls servers by establishing a reverse GRPC tunnel with them and by sending them commands.
@@ -25,7 +26,10 @@ type Controller struct {
 // NewController creates a new agent Controller.
 func NewController(grpcServer grpc.ServiceRegistrar, logger *zap.Logger) *Controller {
 	tunnelHandler := grpctunnel.NewTunnelServiceHandler(
-		grpctunnel.TunnelServiceHandlerOptions{},
+		grpctunnel.TunnelServiceHandlerOptions{
+			OnReverseTunnelOpen:  onReverseTunnelOpen,
+			OnReverseTunnelClose: onReverseTunnelClose,
+		},
 	)
 
 	tunnelpb.RegisterTunnelServiceServer(grpcServer, tunnelHandler.Service())
@@ -42,9 +46,16 @@ func (c *Controller) SetIPMICredentials(ctx context.Context, id, username string
 	channel := c.tunnelHandler.KeyAsChannel(id)
 	cli := agentpb.NewAgentServiceClient(channel)
 
-	response, err := cli.SetIPMICredentials(ctx, &agentpb.SetIPMICredentialsRequest{
-		Username: username,
+	var response *agentpb.SetIPMICredentialsResponse
+
+	err := traceRPC(ctx, id, "set_ipmi_credentials", func(ctx context.Context) (err error) {
+		response, err = cli.SetIPMICredentials(ctx, &agentpb.SetIPMICredentialsRequest{
+			Username: username,
+		})
+
+		return err
 	})
+
 	if err != nil {
 		return "", err
 	}
@@ -57,10 +68,44 @@ func (c *Controller) GetIPMIInfo(ctx context.Context, id string) (ip string, por
 	channel := c.tunnelHandler.KeyAsChannel(id)
 	cli := agentpb.NewAgentServiceClient(channel)
 
-	response, err := cli.GetIPMIInfo(ctx, &agentpb.GetIPMIInfoRequest{})
+	var response *agentpb.GetIPMIInfoResponse
+
+	err = traceRPC(ctx, id, "get_ipmi_info", func(ctx context.Context) (err error) {
+		response, err = cli.GetIPMIInfo(ctx, &agentpb.GetIPMIInfoRequest{})
+
+		return err
+	})
+
 	if err != nil {
 		return "", 0, err
 	}
 
 	return response.Ip, int(response.Port), nil
 }
+
+// ConnectedServer describes a server currently connected to the provider over a reverse tunnel.
+type ConnectedServer struct {
+	// RemoteAddr is the peer address the reverse tunnel was dialed from.
+	//
+	// The metal agent doesn't send a machine ID when it opens its reverse tunnel, so this is the
+	// only thing distinguishing one connected server from another today.
+	RemoteAddr string `json:"remote_addr"`
+}
+
+// ListConnectedServers returns the servers currently connected to the provider over a reverse tunnel.
+func (c *Controller) ListConnectedServers() []ConnectedServer {
+	channels := c.tunnelHandler.AllReverseTunnels()
+	servers := make([]ConnectedServer, 0, len(channels))
+
+	for _, channel := range channels {
+		remoteAddr := "unknown"
+
+		if p, ok := peer.FromContext(channel.Context()); ok && p.Addr != nil {
+			remoteAddr = p.Addr.String()
+		}
+
+		servers = append(servers, ConnectedServer{RemoteAddr: remoteAddr})
+	}
+
+	return servers
+}
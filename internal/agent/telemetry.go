@@ -0,0 +1,86 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/jhump/grpctunnel"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/audit"
+)
+
+// instrumentationName identifies this package's tracer and meter to the OpenTelemetry SDK.
+const instrumentationName = "github.com/siderolabs/omni-infra-provider-bare-metal/internal/agent"
+
+var (
+	tracer = otel.Tracer(instrumentationName)
+	meter  = otel.Meter(instrumentationName)
+
+	tunnelConnectTotal    metric.Int64Counter
+	tunnelDisconnectTotal metric.Int64Counter
+	rpcDuration           metric.Float64Histogram
+)
+
+func init() {
+	var err error
+
+	if tunnelConnectTotal, err = meter.Int64Counter("tunnel_connect_total",
+		metric.WithDescription("Total number of reverse tunnels opened by a server.")); err != nil {
+		panic(err)
+	}
+
+	if tunnelDisconnectTotal, err = meter.Int64Counter("tunnel_disconnect_total",
+		metric.WithDescription("Total number of reverse tunnels torn down.")); err != nil {
+		panic(err)
+	}
+
+	if rpcDuration, err = meter.Float64Histogram("tunnel_rpc_duration_seconds",
+		metric.WithDescription("Duration of RPCs sent to a server over its reverse tunnel, by RPC name and result."),
+		metric.WithUnit("s")); err != nil {
+		panic(err)
+	}
+}
+
+// onReverseTunnelOpen is the grpctunnel.TunnelServiceHandlerOptions.OnReverseTunnelOpen callback:
+// it counts every reverse tunnel a server opens to this provider.
+func onReverseTunnelOpen(grpctunnel.TunnelChannel) {
+	tunnelConnectTotal.Add(context.Background(), 1)
+}
+
+// onReverseTunnelClose is the grpctunnel.TunnelServiceHandlerOptions.OnReverseTunnelClose
+// callback: it counts every reverse tunnel torn down, whether the server disconnected cleanly or
+// the connection was lost.
+func onReverseTunnelClose(grpctunnel.TunnelChannel) {
+	tunnelDisconnectTotal.Add(context.Background(), 1)
+}
+
+// traceRPC wraps a single reverse-tunnel RPC against the server with id in a span, and records
+// its duration in rpcDuration. grpctunnel's channel doesn't expose a stats-handler hook the way a
+// dialed *grpc.ClientConn does, so the RPC is instrumented by hand here instead.
+func traceRPC(ctx context.Context, id, rpcName string, call func(ctx context.Context) error) error {
+	ctx, span := tracer.Start(ctx, "agent."+rpcName, trace.WithAttributes(attribute.String("machine_id", id)))
+	defer span.End()
+
+	start := time.Now()
+
+	err := call(ctx)
+
+	rpcDuration.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributes(attribute.String("rpc", rpcName), attribute.String("result", string(audit.ResultFromErr(err)))))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
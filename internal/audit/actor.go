@@ -0,0 +1,35 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package audit
+
+import "context"
+
+// unknownActor is used when no actor identity could be extracted from the context.
+const unknownActor = "unknown"
+
+type actorContextKey struct{}
+
+// WithActor returns a copy of ctx that carries the given actor identity.
+//
+// Callers set it to name the component that initiated the action, e.g. the admin API or the IPMI
+// credential rotator. Actions performed on behalf of Omni over the reverse tunnel carry no actor
+// and are recorded as unknownActor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	if actor == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor identity carried by ctx, or unknownActor if none was set.
+func ActorFromContext(ctx context.Context) string {
+	actor, ok := ctx.Value(actorContextKey{}).(string)
+	if !ok || actor == "" {
+		return unknownActor
+	}
+
+	return actor
+}
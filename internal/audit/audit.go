@@ -0,0 +1,139 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package audit records a structured, append-only trail of the state-changing
+// actions the provider performs against Omni and against bare-metal hardware.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Result is the outcome of an audited action.
+type Result string
+
+// Known audit results.
+const (
+	ResultSuccess Result = "success"
+	ResultFailure Result = "failure"
+)
+
+// ResultFromErr maps an error to a Result, for the common case of an action that either succeeds
+// or fails outright with no partial-success outcome worth distinguishing.
+func ResultFromErr(err error) Result {
+	if err != nil {
+		return ResultFailure
+	}
+
+	return ResultSuccess
+}
+
+// Action identifies the kind of operation being audited.
+//
+// todo: these actions (together with Record) are the queryable, persisted history of what the
+// provider did to a piece of hardware - ideally surfaced as a COSI resource (e.g. MachineEvent)
+// so it's reachable via `omnictl get`, rather than only the JSON-lines file written by FileSink.
+// That requires a new specs.MachineEventSpec message, generated from the provider's protobuf API
+// definitions, which live outside this module (api/specs) - see the similar todo on
+// resources.BMCSpec. Scoped down to the file sink for now: the provisioning-lifecycle transitions
+// a MachineEvent resource would cover are the ones ProviderServiceServer already writes here -
+// ActionPowerOn (provisioned), ActionPowerCycle (power-cycled, including on deprovision),
+// ActionRemoveMachine (deprovisioned) and ActionGetIPMIInfo/ActionIPMICredentials (IPMI errors).
+type Action string
+
+// Known audit actions.
+const (
+	ActionSaveMachine          Action = "save_machine"
+	ActionRemoveMachine        Action = "remove_machine"
+	ActionEnsureProviderStatus Action = "ensure_provider_status"
+	ActionPowerOn              Action = "power_on"
+	ActionPowerOff             Action = "power_off"
+	ActionPowerCycle           Action = "power_cycle"
+	ActionIPXEChain            Action = "ipxe_chain"
+	ActionDHCPOffer            Action = "dhcp_offer"
+	ActionIPMICredentials      Action = "ipmi_credentials"
+	ActionGetIPMIInfo          Action = "get_ipmi_info"
+	ActionBootDeviceOverride   Action = "boot_device_override"
+)
+
+// Record is a single audit log entry.
+//
+// Records are serialized as a single JSON line, so the field set is kept
+// stable - new fields should only ever be added, never renamed or removed.
+type Record struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Actor         string    `json:"actor"`
+	MachineID     string    `json:"machine_id,omitempty"`
+	Action        Action    `json:"action"`
+	Result        Result    `json:"result"`
+	Error         string    `json:"error,omitempty"`
+	BeforeVersion string    `json:"before_version,omitempty"`
+	AfterVersion  string    `json:"after_version,omitempty"`
+}
+
+// Sink persists audit records. Implementations must be safe for concurrent use.
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+}
+
+// Closer is implemented by sinks that hold resources that need to be released on shutdown.
+type Closer interface {
+	Close() error
+}
+
+// NopSink is a Sink that discards every record.
+//
+// It is used as the default when auditing is not configured, so callers never need to nil-check the sink.
+type NopSink struct{}
+
+// Write implements Sink.
+func (NopSink) Write(context.Context, Record) error { return nil }
+
+type contextKey struct{}
+
+// WithSink returns a copy of ctx that carries the given Sink.
+func WithSink(ctx context.Context, sink Sink) context.Context {
+	return context.WithValue(ctx, contextKey{}, sink)
+}
+
+// SinkFromContext returns the Sink carried by ctx, or NopSink{} if none was set.
+func SinkFromContext(ctx context.Context) Sink {
+	sink, ok := ctx.Value(contextKey{}).(Sink)
+	if !ok || sink == nil {
+		return NopSink{}
+	}
+
+	return sink
+}
+
+// Write records an audit entry using the Sink carried by ctx, filling in the timestamp and actor.
+func Write(ctx context.Context, action Action, machineID string, result Result, before, after string, err error) {
+	record := Record{
+		Timestamp:     time.Now(),
+		Actor:         ActorFromContext(ctx),
+		MachineID:     machineID,
+		Action:        action,
+		Result:        result,
+		BeforeVersion: before,
+		AfterVersion:  after,
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	// Best-effort: a failure to persist an audit record must not fail the operation being audited.
+	_ = SinkFromContext(ctx).Write(ctx, record) //nolint:errcheck
+}
+
+// Fingerprint returns a short, non-reversible identifier for a secret value (e.g. an IPMI
+// password), suitable for correlating audit records without ever persisting the secret itself.
+func Fingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,151 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultMaxSizeBytes is the default size at which a FileSink rotates to a new file.
+const defaultMaxSizeBytes = 100 * 1024 * 1024 // 100 MiB
+
+// FileSink is a Sink that appends records as JSON lines to a file under dir,
+// rotating the file by size and by calendar date.
+//
+// Rotation fsyncs the closed file before opening the next one, so a crash can
+// at worst lose the record currently being written, never truncate a prior one.
+type FileSink struct {
+	dir         string
+	maxSizeByte int64
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openDate string
+}
+
+// NewFileSink creates a FileSink that writes rotated JSON-lines files under dir.
+func NewFileSink(dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log dir: %w", err)
+	}
+
+	sink := &FileSink{
+		dir:         dir,
+		maxSizeByte: defaultMaxSizeBytes,
+	}
+
+	if err := sink.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// Write implements Sink.
+func (s *FileSink) Write(_ context.Context, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := record.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if s.needsRotationLocked(now, int64(len(data))) {
+		if err = s.rotate(now); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+
+	s.size += int64(n)
+
+	return nil
+}
+
+// Close implements Closer.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closeCurrentLocked()
+}
+
+func (s *FileSink) needsRotationLocked(now time.Time, nextWriteSize int64) bool {
+	if s.file == nil {
+		return true
+	}
+
+	if now.Format(time.DateOnly) != s.openDate {
+		return true
+	}
+
+	return s.size+nextWriteSize > s.maxSizeByte
+}
+
+// rotate closes (and fsyncs) the current file, if any, and opens a new one.
+//
+// Callers must hold s.mu.
+func (s *FileSink) rotate(now time.Time) error {
+	if err := s.closeCurrentLocked(); err != nil {
+		return err
+	}
+
+	date := now.Format(time.DateOnly)
+	name := filepath.Join(s.dir, fmt.Sprintf("audit-%s-%d.jsonl", date, now.UnixNano()))
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log file: %w", err)
+	}
+
+	s.file = file
+	s.size = 0
+	s.openDate = date
+
+	return nil
+}
+
+// closeCurrentLocked fsyncs and closes the current file, if any.
+//
+// Callers must hold s.mu.
+func (s *FileSink) closeCurrentLocked() error {
+	if s.file == nil {
+		return nil
+	}
+
+	if err := s.file.Sync(); err != nil {
+		s.file.Close() //nolint:errcheck
+
+		return fmt.Errorf("failed to fsync audit log file: %w", err)
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to close audit log file: %w", err)
+	}
+
+	return nil
+}
@@ -10,12 +10,15 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"text/template"
 
 	"go.uber.org/zap"
+
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/metrics"
 )
 
-const machineConfigTemplate = `apiVersion: v1alpha1
+const baseConfigTemplate = `apiVersion: v1alpha1
 kind: SideroLinkConfig
 apiUrl: {{ .APIURL }}
 ---
@@ -29,15 +32,37 @@ name: omni-kmsg
 url: "tcp://[fdae:41e4:649b:9303::1]:8092"
 `
 
+// clusterLabel is the Omni label carrying the name of the cluster a machine has been assigned to.
+const clusterLabel = "omni.sidero.dev/cluster"
+
+// TemplateContext is exposed to the base config template and to user-supplied config patches.
+type TemplateContext struct {
+	UUID     string
+	MAC      string
+	Serial   string
+	Hostname string
+	APIURL   string
+	Cluster  string
+	Labels   map[string]string
+}
+
 // OmniClient is the interface to interact with Omni.
 type OmniClient interface {
 	GetSiderolinkAPIURL(ctx context.Context) (string, error)
+	GetMachineLabels(ctx context.Context, id string) (map[string]string, error)
+	GetConfigPatches(ctx context.Context, machineID string) ([]string, error)
+	WatchConfigPatches(ctx context.Context) (<-chan struct{}, error)
 }
 
 // Handler handles machine configuration requests.
 type Handler struct {
-	logger        *zap.Logger
-	machineConfig string
+	logger     *zap.Logger
+	omniClient OmniClient
+	apiURL     string
+	baseTmpl   *template.Template
+
+	mu    sync.Mutex
+	cache map[string]string
 }
 
 // NewHandler creates a new Handler.
@@ -47,26 +72,40 @@ func NewHandler(ctx context.Context, omniClient OmniClient, logger *zap.Logger)
 		return nil, fmt.Errorf("failed to get siderolink API URL: %w", err)
 	}
 
-	tmpl, err := template.New("machine-config").Parse(machineConfigTemplate)
+	baseTmpl, err := template.New("base-config").Parse(baseConfigTemplate)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to parse base config template: %w", err)
 	}
 
-	var sb strings.Builder
+	h := &Handler{
+		logger:     logger,
+		omniClient: omniClient,
+		apiURL:     siderolinkAPIURL,
+		baseTmpl:   baseTmpl,
+		cache:      map[string]string{},
+	}
 
-	if err = tmpl.Execute(&sb, struct {
-		APIURL    string
-		JoinToken string
-	}{
-		APIURL: siderolinkAPIURL,
-	}); err != nil {
-		return nil, fmt.Errorf("failed to execute template: %w", err)
+	invalidations, err := omniClient.WatchConfigPatches(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch config patches: %w", err)
 	}
 
-	return &Handler{
-		machineConfig: sb.String(),
-		logger:        logger,
-	}, nil
+	go h.invalidateOnPatchChanges(invalidations)
+
+	return h, nil
+}
+
+// invalidateOnPatchChanges drops the whole render cache every time a config patch changes, until
+// invalidations is closed.
+//
+// Invalidating the whole cache rather than tracking which machine a patch applies to keeps the
+// cache simple; config patches change rarely compared to how often machines PXE boot.
+func (h *Handler) invalidateOnPatchChanges(invalidations <-chan struct{}) {
+	for range invalidations {
+		h.mu.Lock()
+		h.cache = map[string]string{}
+		h.mu.Unlock()
+	}
 }
 
 // ServeHTTP serves the machine configuration.
@@ -74,18 +113,121 @@ func NewHandler(ctx context.Context, omniClient OmniClient, logger *zap.Logger)
 // URL pattern: http://ip-of-this-provider:50042/config?h=${hostname}&m=${mac}&s=${serial}&u=${uuid}
 //
 // Implements http.Handler interface.
-func (s *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	uuid := req.URL.Query().Get("u")
 	mac := req.URL.Query().Get("m")
 	serial := req.URL.Query().Get("s")
 	hostname := req.URL.Query().Get("h")
 
-	s.logger.Info("handle config request", zap.String("uuid", uuid), zap.String("mac", mac), zap.String("serial", serial), zap.String("hostname", hostname))
+	logger := h.logger.With(zap.String("uuid", uuid), zap.String("mac", mac), zap.String("serial", serial), zap.String("hostname", hostname))
+
+	logger.Info("handle config request")
+
+	metrics.ConfigRequestsTotal.Inc()
+
+	cacheKey := cacheKey(uuid, mac, serial, hostname)
+
+	rendered, cached := h.cached(cacheKey)
+	if !cached {
+		var err error
+
+		rendered, err = h.render(req.Context(), uuid, mac, serial, hostname)
+		if err != nil {
+			logger.Error("failed to render machine config", zap.Error(err))
+			http.Error(w, "failed to render machine config", http.StatusInternalServerError)
+
+			return
+		}
+
+		h.store(cacheKey, rendered)
+	}
 
 	w.Header().Set("Content-Type", "text/plain")
 	w.WriteHeader(http.StatusOK)
 
-	if _, err := w.Write([]byte(s.machineConfig)); err != nil {
-		s.logger.Error("failed to write response", zap.Error(err))
+	if _, err := w.Write([]byte(rendered)); err != nil {
+		logger.Error("failed to write response", zap.Error(err))
+	}
+}
+
+// render builds the template context for the requesting machine and renders the base config and
+// its config patches through it.
+func (h *Handler) render(ctx context.Context, uuid, mac, serial, hostname string) (string, error) {
+	labels, err := h.omniClient.GetMachineLabels(ctx, uuid)
+	if err != nil {
+		return "", fmt.Errorf("failed to get machine labels: %w", err)
+	}
+
+	tmplCtx := TemplateContext{
+		UUID:     uuid,
+		MAC:      mac,
+		Serial:   serial,
+		Hostname: hostname,
+		APIURL:   h.apiURL,
+		Cluster:  labels[clusterLabel],
+		Labels:   labels,
 	}
+
+	var sb strings.Builder
+
+	if err = h.baseTmpl.Execute(&sb, tmplCtx); err != nil {
+		return "", fmt.Errorf("failed to execute base config template: %w", err)
+	}
+
+	patches, err := h.omniClient.GetConfigPatches(ctx, uuid)
+	if err != nil {
+		return "", fmt.Errorf("failed to get config patches: %w", err)
+	}
+
+	for i, patch := range patches {
+		patchTmpl, err := template.New(fmt.Sprintf("config-patch-%d", i)).Parse(patch)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse config patch %d: %w", i, err)
+		}
+
+		sb.WriteString("---\n")
+
+		if err = patchTmpl.Execute(&sb, tmplCtx); err != nil {
+			return "", fmt.Errorf("failed to execute config patch %d: %w", i, err)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// cached returns the cached rendered config for key, if any.
+func (h *Handler) cached(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rendered, ok := h.cache[key]
+
+	return rendered, ok
+}
+
+// store caches the rendered config for key.
+func (h *Handler) store(key, rendered string) {
+	if key == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.cache[key] = rendered
+}
+
+// cacheKey builds the render cache key for a request, so that render, which feeds all four
+// fields into the template context (TemplateContext.MAC/Serial/Hostname), never serves a
+// cached body rendered for a different mac/serial/hostname under the same uuid.
+func cacheKey(uuid, mac, serial, hostname string) string {
+	if uuid == "" {
+		return ""
+	}
+
+	return strings.Join([]string{uuid, mac, serial, hostname}, "\x00")
 }
@@ -0,0 +1,115 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package firmware identifies the kind of firmware a PXE/HTTP Boot client is running from the
+// options it advertises, shared between the DHCPv4 and DHCPv6 proxy implementations.
+package firmware
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/siderolabs/gen/xslices"
+)
+
+// httpClientIdentifier is the vendor class identifier value sent by UEFI HTTP Boot clients
+// (DHCPv4 option 60, DHCPv6 option 16).
+const httpClientIdentifier = "HTTPClient"
+
+// Firmware describes a kind of firmware attempting to boot.
+//
+// This should only be used for selecting the right bootloader,
+// kernel selection should key off the more generic architecture.
+type Firmware int
+
+// The bootloaders that we know how to handle.
+const (
+	FirmwareUnsupported Firmware = iota // Unsupported
+	FirmwareX86PC                       // "Classic" x86 BIOS with PXE/UNDI support
+	FirmwareX86EFI                      // EFI x86
+	FirmwareARMEFI                      // EFI ARM64
+	FirmwareX86Ipxe                     // "Classic" x86 BIOS running iPXE (no UNDI support)
+	FirmwareX86HTTP                     // HTTP Boot X86
+	FirmwareARMHTTP                     // ARM64 HTTP Boot
+)
+
+// String returns the Firmware name, used as the Prometheus label value in metrics.DHCPOffersTotal.
+func (f Firmware) String() string {
+	switch f {
+	case FirmwareX86PC:
+		return "x86_pc"
+	case FirmwareX86EFI:
+		return "x86_efi"
+	case FirmwareARMEFI:
+		return "arm_efi"
+	case FirmwareX86Ipxe:
+		return "x86_ipxe"
+	case FirmwareX86HTTP:
+		return "x86_http"
+	case FirmwareARMHTTP:
+		return "arm_http"
+	case FirmwareUnsupported:
+		fallthrough
+	default:
+		return "unsupported"
+	}
+}
+
+// Detect selects the Firmware for a client given its advertised client architectures (DHCPv4
+// option 93, DHCPv6 option 61), vendor class identifier (DHCPv4 option 60, DHCPv6 option 16) and
+// user class values (DHCPv4 option 77, DHCPv6 option 15) - the same information carried by both
+// DHCPv4 and DHCPv6 PXE/HTTP Boot requests, just under different option encodings.
+func Detect(archs iana.Archs, vendorClassID string, userClasses []string) (Firmware, error) {
+	var fwtype Firmware
+
+	for _, arch := range archs {
+		switch arch { //nolint:exhaustive
+		case iana.INTEL_X86PC:
+			fwtype = FirmwareX86PC
+		case iana.EFI_IA32, iana.EFI_X86_64, iana.EFI_BC:
+			fwtype = FirmwareX86EFI
+		case iana.EFI_ARM64:
+			fwtype = FirmwareARMEFI
+		case iana.EFI_X86_HTTP, iana.EFI_X86_64_HTTP:
+			fwtype = FirmwareX86HTTP
+		case iana.EFI_ARM64_HTTP:
+			fwtype = FirmwareARMHTTP
+		}
+	}
+
+	if fwtype == FirmwareUnsupported {
+		return 0, fmt.Errorf("unsupported client arch: %v", xslices.Map(archs, func(a iana.Arch) string { return a.String() }))
+	}
+
+	// RFC 5970 UEFI HTTP Boot clients advertise themselves via the vendor class identifier as
+	// "HTTPClient". Some firmware reports this without a matching HTTP client-arch code, so
+	// cross-check the vendor class value to make sure such clients are still steered to the HTTP
+	// boot path instead of TFTP.
+	if strings.HasPrefix(vendorClassID, httpClientIdentifier) {
+		switch fwtype { //nolint:exhaustive
+		case FirmwareARMEFI, FirmwareARMHTTP:
+			fwtype = FirmwareARMHTTP
+		default:
+			fwtype = FirmwareX86HTTP
+		}
+	}
+
+	// Now, identify special sub-breeds of client firmware based on
+	// the user-class option. Note these only change the "firmware
+	// type", not the architecture we're reporting to Booters. We need
+	// to identify these as part of making the internal chainloading
+	// logic work properly.
+	if len(userClasses) > 0 {
+		// If the client has had iPXE burned into its ROM (or is a VM
+		// that uses iPXE as the PXE "ROM"), special handling is
+		// needed because in this mode the client is using iPXE native
+		// drivers and chainloading to a UNDI stack won't work.
+		if userClasses[0] == "iPXE" && fwtype == FirmwareX86PC {
+			fwtype = FirmwareX86Ipxe
+		}
+	}
+
+	return fwtype, nil
+}
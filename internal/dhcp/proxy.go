@@ -6,72 +6,163 @@ package dhcp
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv4/server4"
-	"github.com/insomniacslk/dhcp/iana"
-	"github.com/siderolabs/gen/xslices"
+	"github.com/insomniacslk/dhcp/dhcpv6/server6"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/audit"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/dhcp/firmware"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/metrics"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/server/httpboot"
 )
 
+// httpBootTokenTTL is how long a signed HTTP boot URL handed out in a DHCP offer remains valid.
+const httpBootTokenTTL = 5 * time.Minute
+
 // Proxy is a DHCP proxy server, adding PXE boot options to the DHCP responses.
 type Proxy struct {
-	logger  *zap.Logger
-	apiHost string
-	apiPort int
+	logger *zap.Logger
+
+	// apiHostV4 and apiHostV6 are the advertised hosts offered to DHCPv4 and DHCPv6 clients
+	// respectively, picked out of apiHosts by address family - see splitAPIHosts. Either may be
+	// empty if no host of that family was configured, in which case the corresponding proxy
+	// logs and ignores any packets it receives.
+	apiHostV4 string
+	apiHostV6 string
+
+	ipxeServerPort     int
+	httpBootSigningKey []byte
 }
 
-// NewProxy creates a new DHCP proxy server.
-func NewProxy(apiHost string, apiPort int, logger *zap.Logger) *Proxy {
+// NewProxy creates a new DHCP proxy server, advertising itself to clients as one of apiHosts -
+// whichever matches the DHCP family (v4/v6) of the request, so a dual-stack deployment (e.g. a
+// management IPv4 network and an IPv6 provisioning network) can be served off a single proxy.
+//
+// If httpBootSigningKey is set, UEFI HTTP Boot URLs handed out in DHCP offers carry a short-lived
+// HMAC-signed token (see httpboot.SignURL), so that anonymous scans on the DHCP-broadcast network
+// cannot pull arbitrary boot artifacts off the HTTP boot endpoint.
+func NewProxy(apiHosts []string, ipxeServerPort int, httpBootSigningKey []byte, logger *zap.Logger) *Proxy {
+	apiHostV4, apiHostV6 := splitAPIHosts(apiHosts)
+
 	return &Proxy{
-		apiHost: apiHost,
-		apiPort: apiPort,
-		logger:  logger,
+		apiHostV4:          apiHostV4,
+		apiHostV6:          apiHostV6,
+		ipxeServerPort:     ipxeServerPort,
+		httpBootSigningKey: httpBootSigningKey,
+		logger:             logger,
 	}
 }
 
-// Run starts the DHCP proxy server.
-func (p *Proxy) Run(ctx context.Context) error {
-	server, err := server4.NewServer(
-		"",
-		nil,
-		p.handlePacket(),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create DHCP server: %w", err)
+// splitAPIHosts returns the first IPv4 and the first IPv6 address found in apiHosts, in that
+// order. Either return value is empty if no address of that family is present.
+func splitAPIHosts(apiHosts []string) (apiHostV4, apiHostV6 string) {
+	for _, host := range apiHosts {
+		ip := net.ParseIP(host)
+
+		switch {
+		case ip == nil:
+			continue
+		case ip.To4() != nil:
+			if apiHostV4 == "" {
+				apiHostV4 = host
+			}
+		default:
+			if apiHostV6 == "" {
+				apiHostV6 = host
+			}
+		}
 	}
 
+	return apiHostV4, apiHostV6
+}
+
+// Run starts the DHCPv4 and DHCPv6 proxy servers, whichever of the two have an api host configured
+// for their family (see splitAPIHosts) - starting server6 on an IPv4-only host with no IPv6 api
+// host configured would otherwise fail to bind the IPv6 multicast groups it needs for no benefit,
+// since handlePacket6 just logs and drops every packet it receives in that case anyway.
+func (p *Proxy) Run(ctx context.Context) error {
 	eg, ctx := errgroup.WithContext(ctx)
 
-	eg.Go(func() error {
-		if err = server.Serve(); err != nil {
-			if errors.Is(err, net.ErrClosed) {
-				return nil
+	if p.apiHostV4 != "" {
+		v4server, err := server4.NewServer(
+			"",
+			nil,
+			p.handlePacket(ctx),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create DHCPv4 server: %w", err)
+		}
+
+		eg.Go(func() error {
+			if err := v4server.Serve(); err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return nil
+				}
+
+				return fmt.Errorf("failed to run DHCPv4 server: %w", err)
 			}
 
-			return fmt.Errorf("failed to run DHCP server: %w", err)
+			return nil
+		})
+
+		eg.Go(func() error {
+			<-ctx.Done()
+
+			return v4server.Close()
+		})
+	}
+
+	if p.apiHostV6 != "" {
+		v6server, err := server6.NewServer(
+			"",
+			nil,
+			p.handlePacket6(ctx),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create DHCPv6 server: %w", err)
 		}
 
-		return nil
-	})
+		eg.Go(func() error {
+			if err := v6server.Serve(); err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return nil
+				}
+
+				return fmt.Errorf("failed to run DHCPv6 server: %w", err)
+			}
 
-	eg.Go(func() error {
-		<-ctx.Done()
+			return nil
+		})
 
-		return server.Close()
-	})
+		eg.Go(func() error {
+			<-ctx.Done()
+
+			return v6server.Close()
+		})
+	}
 
 	return eg.Wait()
 }
 
-func (p *Proxy) handlePacket() func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
+func (p *Proxy) handlePacket(ctx context.Context) func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
 	return func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
 		logger := p.logger.With(zap.String("source", string(m.ClientHWAddr)))
+		machineID := m.ClientHWAddr.String()
+
+		if p.apiHostV4 == "" {
+			logger.Info("ignoring packet: no IPv4 api host configured")
+
+			return
+		}
 
 		if err := isBootDHCP(m); err != nil {
 			logger.Info("ignoring packet", zap.Error(err))
@@ -86,19 +177,24 @@ func (p *Proxy) handlePacket() func(conn net.PacketConn, peer net.Addr, m *dhcpv
 			return
 		}
 
-		resp, err := offerDHCP(m, p.apiHost, p.apiPort, fwtype)
+		resp, err := offerDHCP(m, p.apiHostV4, p.ipxeServerPort, fwtype, p.httpBootSigningKey)
 		if err != nil {
 			logger.Error("failed to construct ProxyDHCP offer", zap.Error(err))
+			audit.Write(ctx, audit.ActionDHCPOffer, machineID, audit.ResultFailure, "", "", err)
 
 			return
 		}
 
+		metrics.DHCPOffersTotal.WithLabelValues(fwtype.String()).Inc()
+
 		logger.Info("offering boot response", zap.String("server", resp.TFTPServerName()), zap.String("boot_filename", resp.BootFileNameOption()))
 
 		_, err = conn.WriteTo(resp.ToBytes(), peer)
 		if err != nil {
 			logger.Error("failure sending response", zap.Error(err))
 		}
+
+		audit.Write(ctx, audit.ActionDHCPOffer, machineID, audit.ResultFromErr(err), "", resp.BootFileNameOption(), err)
 	}
 }
 
@@ -114,41 +210,12 @@ func isBootDHCP(pkt *dhcpv4.DHCPv4) error {
 	return nil
 }
 
-func validateDHCP(m *dhcpv4.DHCPv4) (fwtype Firmware, err error) {
-	arches := m.ClientArch()
-
-	for _, arch := range arches {
-		switch arch { //nolint:exhaustive
-		case iana.INTEL_X86PC:
-			fwtype = FirmwareX86PC
-		case iana.EFI_IA32, iana.EFI_X86_64, iana.EFI_BC:
-			fwtype = FirmwareX86EFI
-		case iana.EFI_ARM64:
-			fwtype = FirmwareARMEFI
-		case iana.EFI_X86_HTTP, iana.EFI_X86_64_HTTP:
-			fwtype = FirmwareX86HTTP
-		case iana.EFI_ARM64_HTTP:
-			fwtype = FirmwareARMHTTP
-		}
-	}
-
-	if fwtype == FirmwareUnsupported {
-		return 0, fmt.Errorf("unsupported client arch: %v", xslices.Map(arches, func(a iana.Arch) string { return a.String() }))
-	}
+func validateDHCP(m *dhcpv4.DHCPv4) (firmware.Firmware, error) {
+	classID := string(m.GetOneOption(dhcpv4.OptionClassIdentifier))
 
-	// Now, identify special sub-breeds of client firmware based on
-	// the user-class option. Note these only change the "firmware
-	// type", not the architecture we're reporting to Booters. We need
-	// to identify these as part of making the internal chainloading
-	// logic work properly.
-	if userClasses := m.UserClass(); len(userClasses) > 0 {
-		// If the client has had iPXE burned into its ROM (or is a VM
-		// that uses iPXE as the PXE "ROM"), special handling is
-		// needed because in this mode the client is using iPXE native
-		// drivers and chainloading to a UNDI stack won't work.
-		if userClasses[0] == "iPXE" && fwtype == FirmwareX86PC {
-			fwtype = FirmwareX86Ipxe
-		}
+	fwtype, err := firmware.Detect(m.ClientArch(), classID, m.UserClass())
+	if err != nil {
+		return 0, err
 	}
 
 	guid := m.GetOneOption(dhcpv4.OptionClientMachineIdentifier)
@@ -170,9 +237,9 @@ func validateDHCP(m *dhcpv4.DHCPv4) (fwtype Firmware, err error) {
 	return fwtype, nil
 }
 
-func offerDHCP(req *dhcpv4.DHCPv4, apiHost string, apiPort int, fwtype Firmware) (*dhcpv4.DHCPv4, error) {
+func offerDHCP(req *dhcpv4.DHCPv4, apiHost string, ipxeServerPort int, fwtype firmware.Firmware, httpBootSigningKey []byte) (*dhcpv4.DHCPv4, error) {
 	serverIP := net.ParseIP(apiHost)
-	ipPort := net.JoinHostPort(serverIP.String(), strconv.Itoa(apiPort))
+	httpBootPort := net.JoinHostPort(serverIP.String(), strconv.Itoa(ipxeServerPort))
 
 	modifiers := []dhcpv4.Modifier{
 		dhcpv4.WithServerIP(serverIP),
@@ -192,28 +259,28 @@ func offerDHCP(req *dhcpv4.DHCPv4, apiHost string, apiPort int, fwtype Firmware)
 	}
 
 	switch fwtype {
-	case FirmwareX86PC:
+	case firmware.FirmwareX86PC:
 		// This is completely standard PXE: just load a file from TFTP.
 		resp.UpdateOption(dhcpv4.OptTFTPServerName(serverIP.String()))
 		resp.UpdateOption(dhcpv4.OptBootFileName("undionly.kpxe"))
-	case FirmwareX86Ipxe:
+	case firmware.FirmwareX86Ipxe:
 		// Almost standard PXE, but the boot filename needs to be a URL.
 		resp.UpdateOption(dhcpv4.OptBootFileName(fmt.Sprintf("tftp://%s/undionly.kpxe", serverIP)))
-	case FirmwareX86EFI:
+	case firmware.FirmwareX86EFI:
 		// This is completely standard PXE: just load a file from TFTP.
 		resp.UpdateOption(dhcpv4.OptTFTPServerName(serverIP.String()))
 		resp.UpdateOption(dhcpv4.OptBootFileName("snp.efi"))
-	case FirmwareARMEFI:
+	case firmware.FirmwareARMEFI:
 		// This is completely standard PXE: just load a file from TFTP.
 		resp.UpdateOption(dhcpv4.OptTFTPServerName(serverIP.String()))
 		resp.UpdateOption(dhcpv4.OptBootFileName("snp-arm64.efi"))
-	case FirmwareX86HTTP:
-		// This is completely standard HTTP-boot: just load a file from HTTP.
-		resp.UpdateOption(dhcpv4.OptBootFileName(fmt.Sprintf("http://%s/tftp/snp.efi", ipPort)))
-	case FirmwareARMHTTP:
-		// This is completely standard HTTP-boot: just load a file from HTTP.
-		resp.UpdateOption(dhcpv4.OptBootFileName(fmt.Sprintf("http://%s/tftp/snp-arm64.efi", ipPort)))
-	case FirmwareUnsupported:
+	case firmware.FirmwareX86HTTP:
+		// UEFI HTTP Boot: point straight at the HTTP-served EFI binary on the iPXE server, skipping TFTP entirely.
+		resp.UpdateOption(dhcpv4.OptBootFileName(httpBootURL(httpBootPort, "snp.efi", clientUUID(req), httpBootSigningKey)))
+	case firmware.FirmwareARMHTTP:
+		// UEFI HTTP Boot: point straight at the HTTP-served EFI binary on the iPXE server, skipping TFTP entirely.
+		resp.UpdateOption(dhcpv4.OptBootFileName(httpBootURL(httpBootPort, "snp-arm64.efi", clientUUID(req), httpBootSigningKey)))
+	case firmware.FirmwareUnsupported:
 		fallthrough
 	default:
 		return nil, fmt.Errorf("unsupported firmware type %d", fwtype)
@@ -222,19 +289,27 @@ func offerDHCP(req *dhcpv4.DHCPv4, apiHost string, apiPort int, fwtype Firmware)
 	return resp, nil
 }
 
-// Firmware describes a kind of firmware attempting to boot.
-//
-// This should only be used for selecting the right bootloader,
-// kernel selection should key off the more generic architecture.
-type Firmware int
-
-// The bootloaders that we know how to handle.
-const (
-	FirmwareUnsupported Firmware = iota // Unsupported
-	FirmwareX86PC                       // "Classic" x86 BIOS with PXE/UNDI support
-	FirmwareX86EFI                      // EFI x86
-	FirmwareARMEFI                      // EFI ARM64
-	FirmwareX86Ipxe                     // "Classic" x86 BIOS running iPXE (no UNDI support)
-	FirmwareX86HTTP                     // HTTP Boot X86
-	FirmwareARMHTTP                     // ARM64 HTTP Boot
-)
+// httpBootURL builds the URL to the HTTP-served boot artifact at relPath, signing it with
+// signingKey if set.
+func httpBootURL(hostPort, relPath, clientUUID string, signingKey []byte) string {
+	url := fmt.Sprintf("http://%s/tftp/%s", hostPort, relPath)
+
+	if signingKey == nil {
+		return url
+	}
+
+	expiry := time.Now().Add(httpBootTokenTTL)
+
+	return url + "?" + httpboot.SignURL(signingKey, relPath, clientUUID, expiry)
+}
+
+// clientUUID returns the client machine identifier (option 97) as a hex string, falling back to
+// the client's hardware address if the client did not send one (see validateDHCP).
+func clientUUID(req *dhcpv4.DHCPv4) string {
+	guid := req.GetOneOption(dhcpv4.OptionClientMachineIdentifier)
+	if len(guid) == 17 {
+		return hex.EncodeToString(guid[1:])
+	}
+
+	return req.ClientHWAddr.String()
+}
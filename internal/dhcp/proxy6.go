@@ -0,0 +1,139 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package dhcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"go.uber.org/zap"
+
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/audit"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/dhcp/firmware"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/metrics"
+)
+
+func (p *Proxy) handlePacket6(ctx context.Context) func(conn net.PacketConn, peer net.Addr, d dhcpv6.DHCPv6) {
+	return func(conn net.PacketConn, peer net.Addr, d dhcpv6.DHCPv6) {
+		msg, err := d.GetInnerMessage()
+		if err != nil {
+			p.logger.Info("ignoring DHCPv6 packet", zap.Error(err))
+
+			return
+		}
+
+		if msg.Type() != dhcpv6.MessageTypeSolicit {
+			p.logger.Info("ignoring DHCPv6 packet", zap.Stringer("type", msg.Type()))
+
+			return
+		}
+
+		machineID := clientUUID6(msg)
+		logger := p.logger.With(zap.String("source", machineID))
+
+		if p.apiHostV6 == "" {
+			logger.Info("ignoring DHCPv6 packet: no IPv6 api host configured")
+
+			return
+		}
+
+		fwtype, err := validateDHCPv6(msg)
+		if err != nil {
+			logger.Info("invalid DHCPv6 packet", zap.Error(err))
+
+			return
+		}
+
+		resp, err := offerDHCPv6(msg, p.apiHostV6, p.ipxeServerPort, fwtype, p.httpBootSigningKey)
+		if err != nil {
+			logger.Error("failed to construct DHCPv6 advertise", zap.Error(err))
+			audit.Write(ctx, audit.ActionDHCPOffer, machineID, audit.ResultFailure, "", "", err)
+
+			return
+		}
+
+		metrics.DHCPOffersTotal.WithLabelValues(fwtype.String()).Inc()
+
+		logger.Info("offering boot response", zap.String("boot_file_url", resp.Options.BootFileURL()))
+
+		_, err = conn.WriteTo(resp.ToBytes(), peer)
+		if err != nil {
+			logger.Error("failure sending response", zap.Error(err))
+		}
+
+		audit.Write(ctx, audit.ActionDHCPOffer, machineID, audit.ResultFromErr(err), "", resp.Options.BootFileURL(), err)
+	}
+}
+
+// validateDHCPv6 detects the Firmware of the client that sent msg.
+//
+// This mirrors validateDHCP, using the DHCPv6 equivalents of the options it reads: the client
+// architecture (option 61, ClientArchType) and vendor class (option 16, VendorClass) in place of
+// DHCPv4 options 93 and 60.
+func validateDHCPv6(msg *dhcpv6.Message) (firmware.Firmware, error) {
+	var vendorClassID string
+
+	if classes := msg.Options.VendorClasses(); len(classes) > 0 && len(classes[0].Data) > 0 {
+		vendorClassID = string(classes[0].Data[0])
+	}
+
+	userClasses := make([]string, len(msg.Options.UserClasses()))
+	for i, uc := range msg.Options.UserClasses() {
+		userClasses[i] = string(uc)
+	}
+
+	return firmware.Detect(msg.Options.ArchTypes(), vendorClassID, userClasses)
+}
+
+func offerDHCPv6(sol *dhcpv6.Message, apiHost string, ipxeServerPort int, fwtype firmware.Firmware, httpBootSigningKey []byte) (*dhcpv6.Message, error) {
+	httpBootPort := net.JoinHostPort(apiHost, strconv.Itoa(ipxeServerPort))
+
+	var relPath string
+
+	switch fwtype {
+	case firmware.FirmwareX86HTTP, firmware.FirmwareX86PC, firmware.FirmwareX86EFI, firmware.FirmwareX86Ipxe:
+		relPath = "snp.efi"
+	case firmware.FirmwareARMHTTP, firmware.FirmwareARMEFI:
+		relPath = "snp-arm64.efi"
+	case firmware.FirmwareUnsupported:
+		fallthrough
+	default:
+		return nil, fmt.Errorf("unsupported firmware type %d", fwtype)
+	}
+
+	adv, err := dhcpv6.NewAdvertiseFromSolicit(sol,
+		dhcpv6.WithServerID(serverDUID(apiHost)),
+		dhcpv6.WithOption(dhcpv6.OptBootFileURL(httpBootURL(httpBootPort, relPath, clientUUID6(sol), httpBootSigningKey))),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return adv, nil
+}
+
+// clientUUID6 returns the client's DUID (option 1, ClientID) as a string, used both as the
+// client identifier in logs/audit entries and as the identity bound into signed HTTP boot URLs.
+func clientUUID6(msg *dhcpv6.Message) string {
+	return msg.Options.ClientID().String()
+}
+
+// serverDUID returns the DUID this proxy identifies itself with in Advertise messages.
+//
+// It is a DUID-UUID (RFC 8415 Section 11.5) derived deterministically from apiHost rather than a
+// link-layer address, since the proxy does not own the interface it listens on.
+func serverDUID(apiHost string) dhcpv6.DUID {
+	sum := sha256.Sum256([]byte(apiHost))
+
+	var id [16]byte
+
+	copy(id[:], sum[:16])
+
+	return &dhcpv6.DUIDUUID{UUID: id}
+}
@@ -0,0 +1,53 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// archNames maps the iPXE "${buildarch}" variable to the arch component of the image factory's
+// PXE path and of the local asset directory layout (matching the "amd64"/"arm64" naming already
+// used for the TFTP-served boot binaries, see patchBinaries).
+var archNames = map[string]string{
+	"i386":   "amd64",
+	"x86_64": "amd64",
+	"arm32":  "arm64",
+	"arm64":  "arm64",
+}
+
+// normalizeArch converts the iPXE buildarch query parameter into the "amd64"/"arm64" naming used
+// by the image factory and by this provider's own boot artifacts.
+func normalizeArch(buildarch string) (string, error) {
+	arch, ok := archNames[buildarch]
+	if !ok {
+		return "", fmt.Errorf("unsupported build architecture %q", buildarch)
+	}
+
+	return arch, nil
+}
+
+// chainScript builds the iPXE script chaining straight to the image factory's PXE endpoint for
+// schematicID, for the given Talos version and architecture.
+func chainScript(factoryPXEURL, schematicID, talosVersion, arch string) []byte {
+	return fmt.Appendf(nil, "#!ipxe\nchain --replace %s/pxe/%s/%s/metal-%s\n",
+		strings.TrimSuffix(factoryPXEURL, "/"), schematicID, talosVersion, arch)
+}
+
+// localScript builds the iPXE script for the "local" boot mode: it serves the kernel/initramfs
+// from this provider itself (see Handler.localAssetsHandler) instead of chaining to the image
+// factory, with the same talos.config/SideroLink kernel arguments buildAndRegisterAgentSchematic
+// would have embedded into the schematic.
+func localScript(endpoint string, port int, siderolinkAPIURL, uuid, mac, serial, hostname string) []byte {
+	configURL := fmt.Sprintf("http://%s:%d/config?h=%s&m=%s&s=%s&u=%s",
+		endpoint, port, url.QueryEscape(hostname), url.QueryEscape(mac), url.QueryEscape(serial), url.QueryEscape(uuid))
+
+	kernelArgs := fmt.Sprintf("siderolink.api=%s talos.config=%s", siderolinkAPIURL, configURL)
+
+	return fmt.Appendf(nil, "#!ipxe\nkernel http://%s:%d/ipxe/local/vmlinuz %s\ninitrd http://%s:%d/ipxe/local/initramfs\nboot\n",
+		endpoint, port, kernelArgs, endpoint, port)
+}
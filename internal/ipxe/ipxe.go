@@ -6,17 +6,63 @@
 package ipxe
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/audit"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/metrics"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/server/httpboot"
 )
 
+// OmniClient is the interface to Omni needed to build the agent schematic's SideroLink kernel
+// argument.
+type OmniClient interface {
+	GetSiderolinkAPIURL(ctx context.Context) (string, error)
+}
+
 // Handler represents an iPXE handler.
 type Handler struct {
-	logger *zap.Logger
+	logger   *zap.Logger
+	manifest ArtifactManifest
+
+	mode           Mode
+	endpoint       string
+	port           int
+	factoryPXEURL  string
+	factoryBaseURL string
+	talosVersion   string
+	omniClient     OmniClient
+
+	// schematicID is set once at startup in ModeChaining, and is shared by every request.
+	schematicID string
+
+	// localAssetsHandler serves the kernel/initramfs configured via WithLocalAssetsDir, and is
+	// only set in ModeLocal.
+	localAssetsHandler http.Handler
+}
+
+// Option configures a Handler.
+type Option func(*options)
+
+type options struct {
+	localAssetsDir string
+}
+
+// WithLocalAssetsDir configures the directory Handler serves the kernel/initramfs from in
+// ModeLocal. Required in ModeLocal, ignored otherwise.
+func WithLocalAssetsDir(dir string) Option {
+	return func(o *options) {
+		o.localAssetsDir = dir
+	}
 }
 
-// ServeHTTP serves the iPXE request.
+// ServeHTTP serves the iPXE request, handing back a boot script that either chains to the image
+// factory (ModeChaining) or serves the agent kernel/initramfs directly (ModeLocal).
 //
 // URL pattern: http://ip-of-this-provider:50042/ipxe?uuid=${uuid}&mac=${net${idx}/mac:hexhyp}&domain=${domain}&hostname=${hostname}&serial=${serial}&arch=${buildarch}
 //
@@ -29,29 +75,130 @@ func (s *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	serial := req.URL.Query().Get("serial")
 	arch := req.URL.Query().Get("arch")
 
-	s.logger.Info("handle iPXE request", zap.String("uuid", uuid), zap.String("mac", mac),
+	logger := s.logger.With(zap.String("uuid", uuid), zap.String("mac", mac),
 		zap.String("domain", domain), zap.String("hostname", hostname), zap.String("serial", serial), zap.String("arch", arch))
 
-	// TODO implement me: boot into the agent mode + partial machine config (talos.config kernel arg) to join Omni SideroLink
-	// Here we need 2 modes:
-	// a. boot via chaining to the factory - build the schematic once and use it for all machines
-	// b. boot by providing kernel and initramfs from this server for the agent development
+	logger.Info("handle iPXE request")
+
+	// Tag the span otelhttp started for this request with the machine identity, so a single slow
+	// or failing boot can be found by UUID in the trace backend without turning it into a
+	// high-cardinality Prometheus label (see metrics.IPXERequestsTotal, which stays keyed by mode).
+	trace.SpanFromContext(req.Context()).SetAttributes(
+		attribute.String("ipxe.uuid", uuid), attribute.String("ipxe.mode", string(s.mode)))
+
+	metrics.IPXERequestsTotal.WithLabelValues(string(s.mode)).Inc()
+
+	script, err := s.buildScript(req.Context(), uuid, mac, serial, hostname, arch)
+
+	audit.Write(req.Context(), audit.ActionIPXEChain, uuid, audit.ResultFromErr(err), "", string(s.mode), err)
+
+	if err != nil {
+		logger.Error("failed to build iPXE boot script", zap.Error(err))
+		http.Error(w, "failed to build iPXE boot script", http.StatusInternalServerError)
+
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/plain")
 	w.WriteHeader(http.StatusOK)
+
+	if _, err = w.Write(script); err != nil {
+		logger.Error("failed to write response", zap.Error(err))
+	}
 }
 
-// NewHandler creates a new iPXE server.
-func NewHandler(endpoint string, port int, logger *zap.Logger) (*Handler, error) {
+// buildScript builds the per-request boot script for the Handler's configured Mode.
+func (s *Handler) buildScript(ctx context.Context, uuid, mac, serial, hostname, buildarch string) ([]byte, error) {
+	normalizedArch, err := normalizeArch(buildarch)
+	if err != nil {
+		return nil, err
+	}
+
+	switch s.mode {
+	case ModeChaining:
+		return chainScript(s.factoryPXEURL, s.schematicID, s.talosVersion, normalizedArch), nil
+	case ModeLocal:
+		siderolinkAPIURL, err := s.omniClient.GetSiderolinkAPIURL(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get siderolink API URL: %w", err)
+		}
+
+		return localScript(s.endpoint, s.port, siderolinkAPIURL, uuid, mac, serial, hostname), nil
+	default:
+		return nil, fmt.Errorf("unsupported iPXE boot mode %q", s.mode)
+	}
+}
+
+// NewHandler creates a new iPXE Handler, patching the iPXE binaries served over TFTP so they
+// chain back to this provider at endpoint:port, and preparing mode for per-request boot script
+// generation.
+//
+// In ModeChaining, the Talos agent schematic is built and registered with the image factory once,
+// here, rather than on every request.
+func NewHandler(
+	ctx context.Context, mode Mode, endpoint string, port int, factoryPXEURL, factoryBaseURL, talosVersion string, omniClient OmniClient, logger *zap.Logger, opts ...Option,
+) (*Handler, error) {
+	var o options
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	logger.Info("patch iPXE binaries")
 
-	if err := patchBinaries(endpoint, port); err != nil {
+	manifest, err := patchBinaries(endpoint, port)
+	if err != nil {
 		return nil, err
 	}
 
 	logger.Info("successfully patched iPXE binaries")
 
-	return &Handler{
-		logger: logger,
-	}, nil
+	handler := &Handler{
+		logger:         logger,
+		manifest:       manifest,
+		mode:           mode,
+		endpoint:       endpoint,
+		port:           port,
+		factoryPXEURL:  factoryPXEURL,
+		factoryBaseURL: factoryBaseURL,
+		talosVersion:   talosVersion,
+		omniClient:     omniClient,
+	}
+
+	switch mode {
+	case ModeChaining:
+		siderolinkAPIURL, err := omniClient.GetSiderolinkAPIURL(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get siderolink API URL: %w", err)
+		}
+
+		handler.schematicID, err = buildAndRegisterAgentSchematic(ctx, factoryBaseURL, endpoint, port, siderolinkAPIURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build agent schematic: %w", err)
+		}
+
+		logger.Info("registered agent schematic with the image factory", zap.String("schematic_id", handler.schematicID))
+	case ModeLocal:
+		if o.localAssetsDir == "" {
+			return nil, fmt.Errorf("local assets directory must be set in %q iPXE boot mode", ModeLocal)
+		}
+
+		handler.localAssetsHandler = httpboot.NewHandler(o.localAssetsDir, logger.With(zap.String("component", "ipxe_local_assets")))
+	default:
+		return nil, fmt.Errorf("unsupported iPXE boot mode %q", mode)
+	}
+
+	return handler, nil
+}
+
+// ManifestHandler returns the handler serving the boot-artifact manifest produced when this
+// Handler's iPXE binaries were patched.
+func (s *Handler) ManifestHandler() *ManifestHandler {
+	return &ManifestHandler{manifest: s.manifest}
+}
+
+// LocalAssetsHandler returns the handler serving the kernel/initramfs configured via
+// WithLocalAssetsDir, or nil if the Handler isn't running in ModeLocal.
+func (s *Handler) LocalAssetsHandler() http.Handler {
+	return s.localAssetsHandler
 }
@@ -0,0 +1,105 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/constants"
+)
+
+// sourceManifestPath is a sha256sum(1)-formatted file shipped alongside the vendor-supplied iPXE
+// binaries, listing their expected pre-patch digests, keyed by path relative to constants.IPXEPath.
+const sourceManifestPath = constants.IPXEPath + "/ipxe.sha256"
+
+// ArtifactManifest records the digests of the boot artifacts produced by patchBinaries, so that
+// operators can confirm which exact boot payload a given machine received.
+type ArtifactManifest struct {
+	// BootScriptSHA256 is the digest of the rendered bootTemplate, which is deterministic per
+	// provider endpoint/port configuration.
+	BootScriptSHA256 string `json:"boot_script_sha256"`
+
+	// Artifacts maps a TFTP-relative artifact path (e.g. "ipxe.efi") to the sha256 digest of the
+	// patched file written to constants.TFTPPath.
+	Artifacts map[string]string `json:"artifacts"`
+}
+
+// ManifestHandler serves the ArtifactManifest recorded during iPXE binary patching.
+type ManifestHandler struct {
+	manifest ArtifactManifest
+}
+
+// ServeHTTP serves the boot-artifact manifest as JSON.
+//
+// Implements http.Handler interface.
+func (h *ManifestHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	_ = json.NewEncoder(w).Encode(h.manifest) //nolint:errcheck
+}
+
+// loadSourceManifest reads and parses sourceManifestPath into a map of relative path to expected
+// sha256 digest.
+func loadSourceManifest() (map[string]string, error) {
+	f, err := os.Open(sourceManifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open iPXE source manifest %q: %w", sourceManifestPath, err)
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	digests := map[string]string{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed line in iPXE source manifest: %q", line)
+		}
+
+		digests[strings.TrimPrefix(fields[1], "*")] = fields[0]
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read iPXE source manifest: %w", err)
+	}
+
+	return digests, nil
+}
+
+// verifySourceDigest checks that contents matches the expected digest for relPath in digests.
+func verifySourceDigest(digests map[string]string, relPath string, contents []byte) error {
+	expected, ok := digests[relPath]
+	if !ok {
+		return fmt.Errorf("no expected digest found for %q in iPXE source manifest", relPath)
+	}
+
+	actual := sha256Hex(contents)
+
+	if actual != expected {
+		return fmt.Errorf("digest mismatch for %q: expected %q, got %q", relPath, expected, actual)
+	}
+
+	return nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
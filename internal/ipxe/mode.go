@@ -0,0 +1,32 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe
+
+import "fmt"
+
+// Mode selects how Handler.ServeHTTP directs a machine to its Talos agent image.
+type Mode string
+
+// Known Modes.
+const (
+	// ModeChaining builds the Talos agent schematic once, registers it with the image factory,
+	// and chains every request straight to the factory's PXE endpoint for that schematic.
+	ModeChaining Mode = "chaining"
+
+	// ModeLocal serves the agent kernel/initramfs from a local directory instead of the image
+	// factory. Useful for agent development, where rebuilding and re-registering a schematic on
+	// every change would be too slow.
+	ModeLocal Mode = "local"
+)
+
+// ParseMode validates and converts s into a Mode, for use with the --ipxe-boot-mode flag.
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(s); mode {
+	case ModeChaining, ModeLocal:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid iPXE boot mode %q, must be one of: %q, %q", s, ModeChaining, ModeLocal)
+	}
+}
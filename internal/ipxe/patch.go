@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -95,43 +96,65 @@ func buildBootScript(endpoint string, port int) ([]byte, error) {
 // EFI iPXE binaries are uncompressed, so these are patched directly.
 // BIOS amd64 undionly.pxe is compressed, so we instead patch uncompressed version and compress it back using zbin.
 // (zbin is built with iPXE).
-func patchBinaries(endpoint string, port int) error {
+//
+// Each source binary is verified against sourceManifestPath before patching, and the digest of
+// every patched output is recorded into the returned ArtifactManifest, so that a corrupted or
+// tampered IPXEPath tree is caught rather than silently poisoning every PXE boot.
+func patchBinaries(endpoint string, port int) (ArtifactManifest, error) {
+	manifest := ArtifactManifest{Artifacts: map[string]string{}}
+
 	bootScript, err := buildBootScript(endpoint, port)
 	if err != nil {
-		return fmt.Errorf("failed to build boot script: %w", err)
+		return manifest, fmt.Errorf("failed to build boot script: %w", err)
+	}
+
+	manifest.BootScriptSHA256 = sha256Hex(bootScript)
+
+	sourceDigests, err := loadSourceManifest()
+	if err != nil {
+		return manifest, err
 	}
 
 	for _, name := range []string{"ipxe", "snp"} {
 		if err = patchScript(
-			fmt.Sprintf(constants.IPXEPath+"/amd64/%s.efi", name),
+			fmt.Sprintf("amd64/%s.efi", name),
 			fmt.Sprintf(constants.TFTPPath+"/%s.efi", name),
-			bootScript,
+			bootScript, sourceDigests, manifest.Artifacts,
 		); err != nil {
-			return fmt.Errorf("failed to patch %q: %w", name, err)
+			return manifest, fmt.Errorf("failed to patch %q: %w", name, err)
 		}
 
 		if err = patchScript(
-			fmt.Sprintf(constants.IPXEPath+"/arm64/%s.efi", name),
+			fmt.Sprintf("arm64/%s.efi", name),
 			fmt.Sprintf(constants.TFTPPath+"/%s-arm64.efi", name),
-			bootScript,
+			bootScript, sourceDigests, manifest.Artifacts,
 		); err != nil {
-			return fmt.Errorf("failed to patch %q: %w", name, err)
+			return manifest, fmt.Errorf("failed to patch %q: %w", name, err)
 		}
 	}
 
-	if err = patchScript(constants.IPXEPath+"/amd64/kpxe/undionly.kpxe.bin", constants.IPXEPath+"/amd64/kpxe/undionly.kpxe.bin.patched", bootScript); err != nil {
-		return fmt.Errorf("failed to patch undionly.kpxe.bin: %w", err)
+	if err = patchScript(
+		"amd64/kpxe/undionly.kpxe.bin", constants.IPXEPath+"/amd64/kpxe/undionly.kpxe.bin.patched",
+		bootScript, sourceDigests, nil,
+	); err != nil {
+		return manifest, fmt.Errorf("failed to patch undionly.kpxe.bin: %w", err)
 	}
 
-	if err = compressKPXE(constants.IPXEPath+"/amd64/kpxe/undionly.kpxe.bin.patched", constants.IPXEPath+"/amd64/kpxe/undionly.kpxe.zinfo", constants.TFTPPath+"/undionly.kpxe"); err != nil {
-		return fmt.Errorf("failed to compress undionly.kpxe: %w", err)
+	if err = compressKPXE(
+		constants.IPXEPath+"/amd64/kpxe/undionly.kpxe.bin.patched", constants.IPXEPath+"/amd64/kpxe/undionly.kpxe.zinfo",
+		constants.TFTPPath+"/undionly.kpxe", manifest.Artifacts,
+	); err != nil {
+		return manifest, fmt.Errorf("failed to compress undionly.kpxe: %w", err)
 	}
 
-	if err = compressKPXE(constants.IPXEPath+"/amd64/kpxe/undionly.kpxe.bin.patched", constants.IPXEPath+"/amd64/kpxe/undionly.kpxe.zinfo", constants.TFTPPath+"/undionly.kpxe.0"); err != nil {
-		return fmt.Errorf("failed to compress undionly.kpxe.0: %w", err)
+	if err = compressKPXE(
+		constants.IPXEPath+"/amd64/kpxe/undionly.kpxe.bin.patched", constants.IPXEPath+"/amd64/kpxe/undionly.kpxe.zinfo",
+		constants.TFTPPath+"/undionly.kpxe.0", manifest.Artifacts,
+	); err != nil {
+		return manifest, fmt.Errorf("failed to compress undionly.kpxe.0: %w", err)
 	}
 
-	return nil
+	return manifest, nil
 }
 
 var (
@@ -139,12 +162,18 @@ var (
 	placeholderEnd   = []byte("# *PLACEHOLDER END*")
 )
 
-func patchScript(source, destination string, script []byte) error {
+func patchScript(relSource, destination string, script []byte, sourceDigests map[string]string, artifacts map[string]string) error {
+	source := constants.IPXEPath + "/" + relSource
+
 	contents, err := os.ReadFile(source)
 	if err != nil {
 		return err
 	}
 
+	if err = verifySourceDigest(sourceDigests, relSource, contents); err != nil {
+		return err
+	}
+
 	start := bytes.Index(contents, placeholderStart)
 	if start == -1 {
 		return fmt.Errorf("placeholder start not found in %q", source)
@@ -175,11 +204,19 @@ func patchScript(source, destination string, script []byte) error {
 		return err
 	}
 
-	return os.WriteFile(destination, contents, 0o644)
+	if err = os.WriteFile(destination, contents, 0o644); err != nil {
+		return err
+	}
+
+	if artifacts != nil {
+		artifacts[filepath.Base(destination)] = sha256Hex(contents)
+	}
+
+	return nil
 }
 
 // compressKPXE is equivalent to: ./util/zbin bin/undionly.kpxe.bin bin/undionly.kpxe.zinfo > bin/undionly.kpxe.zbin.
-func compressKPXE(binFile, infoFile, outFile string) error {
+func compressKPXE(binFile, infoFile, outFile string, artifacts map[string]string) error {
 	out, err := os.Create(outFile)
 	if err != nil {
 		return err
@@ -187,8 +224,10 @@ func compressKPXE(binFile, infoFile, outFile string) error {
 
 	defer out.Close() //nolint:errcheck
 
+	var buf bytes.Buffer
+
 	cmd := exec.Command("/bin/zbin", binFile, infoFile)
-	cmd.Stdout = out
+	cmd.Stdout = io.MultiWriter(out, &buf)
 
 	err = cmd.Run()
 	if err != nil {
@@ -201,5 +240,9 @@ func compressKPXE(binFile, infoFile, outFile string) error {
 		return fmt.Errorf("failed to run zbin: %w", err)
 	}
 
+	if artifacts != nil {
+		artifacts[filepath.Base(outFile)] = sha256Hex(buf.Bytes())
+	}
+
 	return nil
 }
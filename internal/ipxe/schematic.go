@@ -0,0 +1,60 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe
+
+import (
+	"context"
+	"fmt"
+
+	ifclient "github.com/siderolabs/image-factory/pkg/client"
+	"github.com/siderolabs/image-factory/pkg/schematic"
+)
+
+// metalAgentExtension is the official Talos system extension that boots a machine into the
+// bare-metal agent instead of installing Talos onto it.
+const metalAgentExtension = "siderolabs/metal-agent"
+
+// configQueryParams is appended to every per-machine URL embedded into the agent schematic's
+// kernel arguments. The placeholders are iPXE variables, not resolved here: the schematic is
+// registered once and shared by every machine, so it is iPXE - not this provider - that expands
+// them into the actual values when it assembles the kernel command line for a given boot, see
+// config.Handler.ServeHTTP's own URL pattern.
+const configQueryParams = "h=${hostname}&m=${mac}&s=${serial}&u=${uuid}"
+
+// buildAndRegisterAgentSchematic builds the Talos agent schematic - the official metal-agent
+// extension plus kernel arguments that join Omni SideroLink (siderolinkAPIURL) and fetch this
+// provider's machine config (talos.config pointing at endpoint:port/config) - and registers it
+// with the image factory API at factoryBaseURL, returning its schematic ID.
+//
+// factoryBaseURL is the image factory's HTTP API host (e.g. https://factory.talos.dev), not the
+// PXE asset host used to build the chain URL (see chainScript) - SchematicCreate POSTs to
+// factoryBaseURL + "/schematics".
+func buildAndRegisterAgentSchematic(ctx context.Context, factoryBaseURL, endpoint string, port int, siderolinkAPIURL string) (string, error) {
+	configURL := fmt.Sprintf("http://%s:%d/config?%s", endpoint, port, configQueryParams)
+
+	agentSchematic := schematic.Schematic{
+		Customization: schematic.Customization{
+			SystemExtensions: schematic.SystemExtensions{
+				OfficialExtensions: []string{metalAgentExtension},
+			},
+			ExtraKernelArgs: []string{
+				fmt.Sprintf("siderolink.api=%s", siderolinkAPIURL),
+				fmt.Sprintf("talos.config=%s", configURL),
+			},
+		},
+	}
+
+	factoryClient, err := ifclient.New(factoryBaseURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to create image factory client: %w", err)
+	}
+
+	schematicID, err := factoryClient.SchematicCreate(ctx, agentSchematic)
+	if err != nil {
+		return "", fmt.Errorf("failed to register agent schematic with the image factory: %w", err)
+	}
+
+	return schematicID, nil
+}
@@ -0,0 +1,40 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// rpcDuration observes the duration of unary GRPC requests, by method and result status code.
+var rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "grpc_request_duration_seconds",
+	Help:      "Duration of unary GRPC requests, by method and status code.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "code"})
+
+func init() {
+	prometheus.MustRegister(rpcDuration)
+}
+
+// UnaryServerInterceptor returns a grpc.UnaryServerInterceptor recording rpcDuration for every
+// unary RPC, intended to be passed to server.WithUnaryInterceptors.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		rpcDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+
+		return resp, err
+	}
+}
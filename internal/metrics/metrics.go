@@ -0,0 +1,97 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package metrics registers the Prometheus metrics exported by the provider, giving operators
+// visibility into the provisioning lifecycle beyond what's in the audit log and zap logs.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bare_metal_provider"
+
+// ProvisionTotal counts ProviderServiceServer.ProvisionMachine calls, by result ("success" or
+// "failure", mirroring audit.Result).
+var ProvisionTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "provision_total",
+	Help:      "Total number of ProvisionMachine calls, by result.",
+}, []string{"result"})
+
+// DeprovisionTotal counts ProviderServiceServer.DeprovisionMachine calls, by result.
+var DeprovisionTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "deprovision_total",
+	Help:      "Total number of DeprovisionMachine calls, by result.",
+}, []string{"result"})
+
+// IPMICommandDuration observes how long IPMI commands take against a BMC, by operation
+// ("power_on", "power_off", "power_cycle", "status", "set_boot_device").
+var IPMICommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "ipmi_command_duration_seconds",
+	Help:      "Duration of IPMI commands issued against a BMC, by operation.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"op"})
+
+// DHCPOffersTotal counts DHCP boot offers handed out by the proxy, by firmware type.
+var DHCPOffersTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "dhcp_offers_total",
+	Help:      "Total number of DHCP boot offers sent, by firmware type.",
+}, []string{"fwtype"})
+
+// TFTPFilesServedTotal counts files served over TFTP.
+var TFTPFilesServedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "tftp_files_served_total",
+	Help:      "Total number of files served over TFTP.",
+})
+
+// ConfigRequestsTotal counts machine configuration requests served.
+var ConfigRequestsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "config_requests_total",
+	Help:      "Total number of machine configuration requests served.",
+})
+
+// IPXERequestsTotal counts iPXE boot script requests served, by boot mode ("chaining" or
+// "local").
+var IPXERequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "ipxe_requests_total",
+	Help:      "Total number of iPXE boot script requests served, by boot mode.",
+}, []string{"mode"})
+
+func init() {
+	prometheus.MustRegister(
+		ProvisionTotal,
+		DeprovisionTotal,
+		IPMICommandDuration,
+		DHCPOffersTotal,
+		TFTPFilesServedTotal,
+		ConfigRequestsTotal,
+		IPXERequestsTotal,
+	)
+}
+
+// Handler returns the HTTP handler exposing the registered metrics in the Prometheus exposition
+// format, to be mounted on the "/metrics" route.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ResultLabel maps whether an operation succeeded to the "result" label value used across the
+// counters above, mirroring audit.Result so the two stay easy to cross-reference.
+func ResultLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+
+	return "success"
+}
@@ -6,15 +6,19 @@
 package omni
 
 import (
+	"cmp"
 	"context"
 	"encoding/base64"
 	"fmt"
+	"maps"
 	"os"
 
+	"github.com/cosi-project/runtime/pkg/resource"
 	"github.com/cosi-project/runtime/pkg/safe"
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/siderolabs/omni/client/pkg/client"
 	"github.com/siderolabs/omni/client/pkg/jointoken"
+	omniresources "github.com/siderolabs/omni/client/pkg/omni/resources"
 	"github.com/siderolabs/omni/client/pkg/omni/resources/infra"
 	"github.com/siderolabs/omni/client/pkg/omni/resources/omni"
 	"github.com/siderolabs/omni/client/pkg/omni/resources/siderolink"
@@ -24,7 +28,9 @@ import (
 
 	providerpb "github.com/siderolabs/omni-infra-provider-bare-metal/api/provider"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/api/specs"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/audit"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/meta"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/power"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/resources"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/service"
 )
@@ -90,7 +96,11 @@ func (c *Client) GetSiderolinkAPIURL(ctx context.Context) (string, error) {
 }
 
 // EnsureProviderStatus makes sure that the infra.ProviderStatus resource exists and is up to date for this provider.
-func (c *Client) EnsureProviderStatus(ctx context.Context, name, description string, rawIcon []byte) error {
+func (c *Client) EnsureProviderStatus(ctx context.Context, name, description string, rawIcon []byte) (err error) {
+	defer func() {
+		audit.Write(ctx, audit.ActionEnsureProviderStatus, meta.ProviderID, audit.ResultFromErr(err), "", "", err)
+	}()
+
 	providerStatus := infra.NewProviderStatus(meta.ProviderID)
 
 	providerStatus.TypedSpec().Value.Name = name
@@ -102,7 +112,7 @@ func (c *Client) EnsureProviderStatus(ctx context.Context, name, description str
 
 	st := c.omniClient.Omni().State()
 
-	if err := st.Create(ctx, providerStatus); err != nil {
+	if err = st.Create(ctx, providerStatus); err != nil {
 		if !state.IsConflictError(err) {
 			return err
 		}
@@ -121,9 +131,9 @@ func (c *Client) EnsureProviderStatus(ctx context.Context, name, description str
 }
 
 // RunReverseTunnel starts the reverse GRPC tunnel to Omni.
-func (c *Client) RunReverseTunnel(ctx context.Context, agentController service.AgentController, logger *zap.Logger) error {
+func (c *Client) RunReverseTunnel(ctx context.Context, agentController service.AgentController, bmcCredentials power.Credentials, logger *zap.Logger) error {
 	reverseTunnelServer := c.omniClient.Tunnel()
-	providerServiceServer := service.NewProviderServiceServer(agentController, c, logger)
+	providerServiceServer := service.NewProviderServiceServer(agentController, c, bmcCredentials, logger)
 
 	providerpb.RegisterProviderServiceServer(reverseTunnelServer, providerServiceServer)
 
@@ -149,13 +159,44 @@ func (c *Client) GetMachine(ctx context.Context, id string) (*resources.Machine,
 	return machine, nil
 }
 
+// ListMachines returns every machine persisted in the provider's state.
+func (c *Client) ListMachines(ctx context.Context) ([]*resources.Machine, error) {
+	list, err := safe.StateListAll[*resources.Machine](ctx, c.omniClient.Omni().State())
+	if err != nil {
+		return nil, err
+	}
+
+	machines := make([]*resources.Machine, 0, list.Len())
+
+	for i := range list.Len() {
+		machines = append(machines, list.Get(i))
+	}
+
+	return machines, nil
+}
+
 // SaveMachine saves the machine with the given ID and spec to the persistent state.
-func (c *Client) SaveMachine(ctx context.Context, id string, spec *specs.MachineSpec) (*resources.Machine, error) {
+func (c *Client) SaveMachine(ctx context.Context, id string, spec *specs.MachineSpec) (machine *resources.Machine, err error) {
+	beforeVersion := ""
+
+	if existing, getErr := c.GetMachine(ctx, id); getErr == nil {
+		beforeVersion = existing.Metadata().Version().String()
+	}
+
+	defer func() {
+		afterVersion := ""
+		if machine != nil {
+			afterVersion = machine.Metadata().Version().String()
+		}
+
+		audit.Write(ctx, audit.ActionSaveMachine, id, audit.ResultFromErr(err), beforeVersion, afterVersion, err)
+	}()
+
 	st := c.omniClient.Omni().State()
-	machine := resources.NewMachine(id)
+	machine = resources.NewMachine(id)
 	machine.TypedSpec().Value = spec
 
-	if err := st.Create(ctx, machine); err != nil {
+	if err = st.Create(ctx, machine); err != nil {
 		if !state.IsConflictError(err) {
 			return nil, err
 		}
@@ -174,14 +215,111 @@ func (c *Client) SaveMachine(ctx context.Context, id string, spec *specs.Machine
 }
 
 // RemoveMachine removes the machine from the persistent state with the given ID.
-func (c *Client) RemoveMachine(ctx context.Context, id string) error {
+func (c *Client) RemoveMachine(ctx context.Context, id string) (err error) {
+	beforeVersion := ""
+
+	if existing, getErr := c.GetMachine(ctx, id); getErr == nil {
+		beforeVersion = existing.Metadata().Version().String()
+	}
+
+	defer func() {
+		audit.Write(ctx, audit.ActionRemoveMachine, id, audit.ResultFromErr(err), beforeVersion, "", err)
+	}()
+
 	st := c.omniClient.Omni().State()
 
-	if err := st.Destroy(ctx, resources.NewMachine(id).Metadata()); err != nil {
+	if err = st.Destroy(ctx, resources.NewMachine(id).Metadata()); err != nil {
 		if !state.IsNotFoundError(err) {
 			return err
 		}
+
+		err = nil
 	}
 
 	return nil
 }
+
+// GetMachineLabels returns the labels of the Omni MachineStatus resource with the given ID (the
+// machine's UUID), or nil if the machine hasn't been registered with Omni yet, e.g. it is still
+// PXE-booting for the first time.
+func (c *Client) GetMachineLabels(ctx context.Context, id string) (map[string]string, error) {
+	machineStatus, err := safe.StateGetByID[*omni.MachineStatus](ctx, c.omniClient.Omni().State(), id)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return maps.Clone(machineStatus.Metadata().Labels().Raw()), nil
+}
+
+// GetConfigPatches returns the decompressed data of every ConfigPatch resource targeting the
+// machine with the given UUID (see omni.LabelMachine), ordered by resource ID so that patch
+// application order is deterministic.
+func (c *Client) GetConfigPatches(ctx context.Context, machineID string) ([]string, error) {
+	st := c.omniClient.Omni().State()
+
+	patches, err := safe.StateList[*omni.ConfigPatch](ctx, st,
+		resource.NewMetadata(omniresources.DefaultNamespace, omni.ConfigPatchType, "", resource.VersionUndefined),
+		state.WithLabelQuery(resource.LabelEqual(omni.LabelMachine, machineID)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list config patches: %w", err)
+	}
+
+	patches.SortFunc(func(a, b *omni.ConfigPatch) int {
+		return cmp.Compare(a.Metadata().ID(), b.Metadata().ID())
+	})
+
+	data := make([]string, 0, patches.Len())
+
+	for i := range patches.Len() {
+		buffer, err := patches.Get(i).TypedSpec().Value.GetUncompressedData()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress config patch %q: %w", patches.Get(i).Metadata().ID(), err)
+		}
+
+		data = append(data, string(buffer.Data()))
+
+		buffer.Free()
+	}
+
+	return data, nil
+}
+
+// WatchConfigPatches sends a signal on the returned channel every time a ConfigPatch resource is
+// created, updated or deleted, so that callers caching rendered config can invalidate their cache.
+//
+// The channel is closed when ctx is done.
+func (c *Client) WatchConfigPatches(ctx context.Context) (<-chan struct{}, error) {
+	events := make(chan state.Event)
+
+	if err := c.omniClient.Omni().State().WatchKind(ctx,
+		resource.NewMetadata(omniresources.DefaultNamespace, omni.ConfigPatchType, "", resource.VersionUndefined),
+		events,
+	); err != nil {
+		return nil, fmt.Errorf("failed to watch config patches: %w", err)
+	}
+
+	signal := make(chan struct{}, 1)
+
+	go func() {
+		defer close(signal)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-events:
+				select {
+				case signal <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return signal, nil
+}
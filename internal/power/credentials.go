@@ -0,0 +1,43 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package power
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credentials is a BMC username/password pair.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// ReadCredentialsDir reads BMC credentials from a Kubernetes-style secret volume mount, i.e. a
+// directory containing one file per key ("username", "password").
+func ReadCredentialsDir(dir string) (Credentials, error) {
+	username, err := readSecretFile(dir, "username")
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	password, err := readSecretFile(dir, "password")
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return Credentials{Username: username, Password: password}, nil
+}
+
+func readSecretFile(dir, key string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, key))
+	if err != nil {
+		return "", fmt.Errorf("failed to read BMC credentials key %q: %w", key, err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
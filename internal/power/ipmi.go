@@ -0,0 +1,125 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package power
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	goipmi "github.com/pensando/goipmi"
+
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/metrics"
+)
+
+// IPMIManager is a Manager backed by IPMI 2.0 over LAN (lanplus).
+type IPMIManager struct {
+	conn *goipmi.Connection
+}
+
+// NewIPMIManager creates a new IPMIManager for the given Config.
+func NewIPMIManager(cfg Config) *IPMIManager {
+	return &IPMIManager{
+		conn: &goipmi.Connection{
+			Hostname:  cfg.Address,
+			Port:      cfg.Port,
+			Username:  cfg.Username,
+			Password:  cfg.Password,
+			Interface: "lanplus",
+		},
+	}
+}
+
+// On implements Manager.
+func (m *IPMIManager) On(context.Context) error {
+	return m.withClient("power_on", func(client *goipmi.Client) error {
+		return client.Control(goipmi.ControlPowerUp)
+	})
+}
+
+// Off implements Manager.
+func (m *IPMIManager) Off(context.Context) error {
+	return m.withClient("power_off", func(client *goipmi.Client) error {
+		return client.Control(goipmi.ControlPowerDown)
+	})
+}
+
+// Cycle implements Manager.
+func (m *IPMIManager) Cycle(context.Context) error {
+	return m.withClient("power_cycle", func(client *goipmi.Client) error {
+		return client.Control(goipmi.ControlPowerCycle)
+	})
+}
+
+// Status implements Manager.
+func (m *IPMIManager) Status(context.Context) (State, error) {
+	var state State
+
+	err := m.withClient("status", func(client *goipmi.Client) error {
+		req := &goipmi.Request{
+			NetworkFunction: goipmi.NetworkFunctionChassis,
+			Command:         goipmi.CommandChassisStatus,
+			Data:            &goipmi.ChassisStatusRequest{},
+		}
+
+		res := &goipmi.ChassisStatusResponse{}
+		if err := client.Send(req, res); err != nil {
+			return err
+		}
+
+		if res.IsSystemPowerOn() {
+			state = StateOn
+		} else {
+			state = StateOff
+		}
+
+		return nil
+	})
+	if err != nil {
+		return StateUnknown, err
+	}
+
+	return state, nil
+}
+
+// SetBootDevice implements Manager.
+func (m *IPMIManager) SetBootDevice(_ context.Context, device BootDevice) error {
+	switch device {
+	case BootDevicePXE:
+		return m.withClient("set_boot_device", func(client *goipmi.Client) error {
+			return client.SetBootDevice(goipmi.BootDevicePxe)
+		})
+	case BootDeviceUEFIHTTP:
+		// IPMI has no boot device selector dedicated to UEFI HTTP Boot: set the EFI boot flag
+		// alongside the PXE selector, which UEFI HTTP Boot-capable firmware resolves to HTTP boot.
+		return m.withClient("set_boot_device", func(client *goipmi.Client) error {
+			return client.SetBootDeviceEFI(goipmi.BootDevicePxe)
+		})
+	case BootDeviceDisk:
+		return m.withClient("set_boot_device", func(client *goipmi.Client) error {
+			return client.SetBootDevice(goipmi.BootDeviceDisk)
+		})
+	default:
+		return fmt.Errorf("unsupported boot device %q", device)
+	}
+}
+
+// withClient opens an IPMI client, runs f against it, and records its duration under the given
+// Prometheus op label.
+func (m *IPMIManager) withClient(op string, f func(client *goipmi.Client) error) error {
+	start := time.Now()
+	defer func() {
+		metrics.IPMICommandDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	}()
+
+	client, err := goipmi.NewClient(m.conn)
+	if err != nil {
+		return fmt.Errorf("failed to create IPMI client: %w", err)
+	}
+
+	defer client.Close() //nolint:errcheck
+
+	return f(client)
+}
@@ -0,0 +1,79 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package power implements BMC-driven power and boot-device management, with pluggable backends.
+package power
+
+import (
+	"context"
+	"fmt"
+)
+
+// State is the observed power state of a machine.
+type State string
+
+// Known power states.
+const (
+	StateOn      State = "on"
+	StateOff     State = "off"
+	StateUnknown State = "unknown"
+)
+
+// BootDevice is a one-shot boot device override applied on the next boot.
+type BootDevice string
+
+// Known boot devices.
+const (
+	BootDevicePXE      BootDevice = "pxe"
+	BootDeviceDisk     BootDevice = "disk"
+	BootDeviceUEFIHTTP BootDevice = "uefi-http"
+)
+
+// Manager controls the power state and boot device of a single machine's BMC.
+//
+// Implementations talk to the BMC directly (IPMI, Redfish, ...); they do not go through the
+// reverse-tunneled Talos metal agent.
+type Manager interface {
+	// On powers the machine on.
+	On(ctx context.Context) error
+	// Off powers the machine off (hard power-off).
+	Off(ctx context.Context) error
+	// Cycle power-cycles the machine (off then on).
+	Cycle(ctx context.Context) error
+	// Status returns the current power state.
+	Status(ctx context.Context) (State, error)
+	// SetBootDevice sets a one-shot boot device override for the next boot.
+	SetBootDevice(ctx context.Context, device BootDevice) error
+}
+
+// DriverType identifies which Manager implementation to build for a BMC.
+type DriverType string
+
+// Known driver types.
+const (
+	DriverIPMI    DriverType = "ipmi"
+	DriverRedfish DriverType = "redfish"
+)
+
+// Config configures how to reach and authenticate against a machine's BMC.
+type Config struct {
+	Driver    DriverType
+	Address   string
+	Port      int
+	Username  string
+	Password  string
+	VerifyTLS bool
+}
+
+// New builds a Manager for the given Config.
+func New(cfg Config) (Manager, error) {
+	switch cfg.Driver {
+	case DriverIPMI, "":
+		return NewIPMIManager(cfg), nil
+	case DriverRedfish:
+		return NewRedfishManager(cfg), nil
+	default:
+		return nil, fmt.Errorf("unsupported BMC driver type %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,46 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package power
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// probeTimeout bounds how long ProbeDriver waits for the BMC to answer before falling back to IPMI.
+const probeTimeout = 5 * time.Second
+
+// ProbeDriver determines which protocol a BMC speaks by requesting its Redfish service root.
+//
+// BMCs that do not answer, or that don't answer with a successful status, are assumed to only
+// support IPMI over LAN, which is the lowest common denominator for server BMCs.
+func ProbeDriver(ctx context.Context, address string, verifyTLS bool) DriverType {
+	client := &http.Client{
+		Timeout: probeTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: !verifyTLS}, //nolint:gosec
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+address+"/redfish/v1/", nil)
+	if err != nil {
+		return DriverIPMI
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return DriverIPMI
+	}
+
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return DriverIPMI
+	}
+
+	return DriverRedfish
+}
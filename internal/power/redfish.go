@@ -0,0 +1,160 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package power
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// defaultRedfishSystemID is used when the BMC exposes a single Computer System, which covers the
+// overwhelming majority of single-node bare-metal BMCs.
+const defaultRedfishSystemID = "1"
+
+// RedfishManager is a Manager backed by the Redfish REST API (DMTF DSP0266).
+type RedfishManager struct {
+	baseURL  string
+	systemID string
+	username string
+	password string
+
+	httpClient *http.Client
+}
+
+// NewRedfishManager creates a new RedfishManager for the given Config.
+//
+// cfg.Address is expected to be a base URL, e.g. "https://10.0.0.5".
+func NewRedfishManager(cfg Config) *RedfishManager {
+	return &RedfishManager{
+		baseURL:  cfg.Address,
+		systemID: defaultRedfishSystemID,
+		username: cfg.Username,
+		password: cfg.Password,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: !cfg.VerifyTLS}, //nolint:gosec
+			},
+		},
+	}
+}
+
+// On implements Manager.
+func (m *RedfishManager) On(ctx context.Context) error {
+	return m.reset(ctx, "On")
+}
+
+// Off implements Manager.
+func (m *RedfishManager) Off(ctx context.Context) error {
+	return m.reset(ctx, "ForceOff")
+}
+
+// Cycle implements Manager.
+func (m *RedfishManager) Cycle(ctx context.Context) error {
+	return m.reset(ctx, "ForceRestart")
+}
+
+// Status implements Manager.
+func (m *RedfishManager) Status(ctx context.Context) (State, error) {
+	var system struct {
+		PowerState string `json:"PowerState"`
+	}
+
+	if err := m.do(ctx, http.MethodGet, m.systemPath(), nil, &system); err != nil {
+		return StateUnknown, err
+	}
+
+	switch system.PowerState {
+	case "On":
+		return StateOn, nil
+	case "Off":
+		return StateOff, nil
+	default:
+		return StateUnknown, nil
+	}
+}
+
+// SetBootDevice implements Manager.
+func (m *RedfishManager) SetBootDevice(ctx context.Context, device BootDevice) error {
+	var target string
+
+	switch device {
+	case BootDevicePXE:
+		target = "Pxe"
+	case BootDeviceDisk:
+		target = "Hdd"
+	case BootDeviceUEFIHTTP:
+		target = "UefiHttp"
+	default:
+		return fmt.Errorf("unsupported boot device %q", device)
+	}
+
+	body := map[string]any{
+		"Boot": map[string]any{
+			"BootSourceOverrideEnabled": "Once",
+			"BootSourceOverrideTarget":  target,
+		},
+	}
+
+	return m.do(ctx, http.MethodPatch, m.systemPath(), body, nil)
+}
+
+// reset issues a ComputerSystem.Reset action with the given ResetType.
+func (m *RedfishManager) reset(ctx context.Context, resetType string) error {
+	body := map[string]any{"ResetType": resetType}
+
+	return m.do(ctx, http.MethodPost, m.systemPath()+"/Actions/ComputerSystem.Reset", body, nil)
+}
+
+func (m *RedfishManager) systemPath() string {
+	return "/redfish/v1/Systems/" + m.systemID
+}
+
+func (m *RedfishManager) do(ctx context.Context, method, path string, body, out any) error {
+	var reqBody *bytes.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal Redfish request body: %w", err)
+		}
+
+		reqBody = bytes.NewReader(data)
+	} else {
+		reqBody = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, m.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to build Redfish request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(m.username, m.password)
+
+	res, err := m.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to perform Redfish request: %w", err)
+	}
+
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("redfish request to %q failed with status %d", path, res.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Redfish response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package ipmirotate periodically rotates the IPMI credentials of bare-metal servers, persisting
+// the new password both to a SecretStore and back to Omni.
+//
+// A machine only has a usable reverse tunnel while it is still PXE-booted into agent mode - once
+// it is provisioned, the agent (and its tunnel) is gone. Since the metal agent doesn't send a
+// machine ID when it opens its reverse tunnel (see agent.Controller.ListConnectedServers), the
+// Rotator can't enumerate "currently tunnel-connected servers" by ID directly; instead it attempts
+// a rotation for every machine Omni knows about, and treats a SetIPMICredentials failure for an
+// already-provisioned (no longer agent-mode) machine as an expected, logged miss rather than a
+// fatal error.
+package ipmirotate
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/siderolabs/omni-infra-provider-bare-metal/api/specs"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/audit"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/resources"
+)
+
+// actor identifies the Rotator as the audit.Record actor for the credential rotations it triggers.
+const actor = "ipmi_rotate"
+
+// AgentController is the interface to send commands to the Talos metal agent.
+type AgentController interface {
+	SetIPMICredentials(ctx context.Context, id, username string) (string, error)
+}
+
+// OmniClient is the interface to read and persist resources.Machine resources.
+type OmniClient interface {
+	ListMachines(ctx context.Context) ([]*resources.Machine, error)
+	SaveMachine(ctx context.Context, id string, spec *specs.MachineSpec) (*resources.Machine, error)
+}
+
+// Config configures a Rotator.
+type Config struct {
+	// Interval is how often the fleet is swept for machines due a rotation.
+	Interval time.Duration
+
+	// Jitter bounds a random per-machine delay added before each rotation, so a large fleet
+	// doesn't hit every machine's agent and Omni at once.
+	Jitter time.Duration
+
+	// DryRun logs the rotation that would have happened instead of performing it.
+	DryRun bool
+
+	// Username is the IPMI username requested from the agent, matching the one
+	// service.ProviderServiceServer requests during provisioning.
+	Username string
+}
+
+// Rotator periodically rotates IPMI credentials, see the package doc.
+type Rotator struct {
+	agentController AgentController
+	omniClient      OmniClient
+	secretStore     SecretStore
+	cfg             Config
+	logger          *zap.Logger
+}
+
+// NewRotator creates a new Rotator.
+func NewRotator(agentController AgentController, omniClient OmniClient, secretStore SecretStore, cfg Config, logger *zap.Logger) *Rotator {
+	return &Rotator{
+		agentController: agentController,
+		omniClient:      omniClient,
+		secretStore:     secretStore,
+		cfg:             cfg,
+		logger:          logger,
+	}
+}
+
+// Run sweeps the fleet for credential rotations every cfg.Interval, until ctx is done.
+func (r *Rotator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.rotateFleet(ctx)
+		}
+	}
+}
+
+// rotateFleet attempts a rotation for every machine Omni knows about, logging (rather than
+// failing the whole sweep on) a per-machine error.
+func (r *Rotator) rotateFleet(ctx context.Context) {
+	machines, err := r.omniClient.ListMachines(ctx)
+	if err != nil {
+		r.logger.Error("failed to list machines for IPMI rotation", zap.Error(err))
+
+		return
+	}
+
+	for _, machine := range machines {
+		if r.cfg.Jitter > 0 {
+			select {
+			case <-time.After(rand.N(r.cfg.Jitter)):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err = r.rotateOne(ctx, machine); err != nil {
+			r.logger.Warn("failed to rotate IPMI credentials", zap.String("machine_id", machine.Metadata().ID()), zap.Error(err))
+		}
+	}
+}
+
+// rotateOne rotates the IPMI credentials of a single machine.
+func (r *Rotator) rotateOne(ctx context.Context, machine *resources.Machine) error {
+	id := machine.Metadata().ID()
+
+	if r.cfg.DryRun {
+		r.logger.Info("dry-run: would rotate IPMI credentials", zap.String("machine_id", id))
+
+		return nil
+	}
+
+	ctx = audit.WithActor(ctx, actor)
+
+	password, err := r.agentController.SetIPMICredentials(ctx, id, r.cfg.Username)
+
+	// The password itself must never be written to the audit trail in plaintext - only a
+	// fingerprint, so operators can still correlate records without it becoming a secrets leak.
+	var fingerprint string
+	if err == nil {
+		fingerprint = audit.Fingerprint(password)
+	}
+
+	audit.Write(ctx, audit.ActionIPMICredentials, id, audit.ResultFromErr(err), "", fingerprint, err)
+
+	if err != nil {
+		return fmt.Errorf("failed to set IPMI credentials: %w", err)
+	}
+
+	if err = r.secretStore.Put(ctx, id, password); err != nil {
+		return fmt.Errorf("failed to persist rotated IPMI credentials: %w", err)
+	}
+
+	spec := machine.TypedSpec().Value
+
+	if _, err = r.omniClient.SaveMachine(ctx, id, &specs.MachineSpec{
+		IpmiIp:       spec.IpmiIp,
+		IpmiPort:     spec.IpmiPort,
+		IpmiPassword: password,
+	}); err != nil {
+		return fmt.Errorf("failed to save rotated IPMI credentials to Omni: %w", err)
+	}
+
+	r.logger.Info("rotated IPMI credentials", zap.String("machine_id", id))
+
+	return nil
+}
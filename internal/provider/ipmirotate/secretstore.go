@@ -0,0 +1,85 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipmirotate
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SecretStore persists a machine's rotated IPMI password out-of-band from the Omni resource
+// model, so the current credential survives even if Omni state is lost or rolled back.
+//
+// Implementations must be safe for concurrent use.
+type SecretStore interface {
+	// Put persists password as the current IPMI credential for the machine with the given ID.
+	Put(ctx context.Context, id, password string) error
+}
+
+// FileStore is a SecretStore that seals each machine's password with AES-GCM and writes it to its
+// own file under dir, named after the machine ID.
+//
+// FileStore is the default SecretStore; the interface exists so that a Vault- or KMS-backed
+// implementation can be dropped in without changing Rotator.
+type FileStore struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+// NewFileStore creates a FileStore that writes under dir, encrypting with key, which must be 16,
+// 24 or 32 bytes long (AES-128/192/256).
+func NewFileStore(dir string, key []byte) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create secret store dir: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES-GCM AEAD: %w", err)
+	}
+
+	return &FileStore{dir: dir, aead: aead}, nil
+}
+
+// Put implements SecretStore.
+func (s *FileStore) Put(_ context.Context, id, password string) error {
+	path, err := s.pathFor(id)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, []byte(password), nil)
+
+	if err = os.WriteFile(path, sealed, 0o600); err != nil {
+		return fmt.Errorf("failed to write secret file: %w", err)
+	}
+
+	return nil
+}
+
+// pathFor returns the file path to store id's secret at, rejecting any ID that would escape dir.
+func (s *FileStore) pathFor(id string) (string, error) {
+	if id == "" || strings.Contains(id, "/") || strings.Contains(id, "..") {
+		return "", fmt.Errorf("invalid machine ID %q", id)
+	}
+
+	return filepath.Join(s.dir, id), nil
+}
@@ -6,58 +6,174 @@
 package provider
 
 import (
+	"bytes"
 	"context"
 	_ "embed"
 	"fmt"
+	"os"
+	"time"
 
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/admin"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/agent"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/audit"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/config"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/constants"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/dhcp"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/ipxe"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/metrics"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/omni"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/power"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/provider/ipmirotate"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/server"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/server/httpboot"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/telemetry"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/tftp"
 )
 
 //go:embed data/icon.svg
 var icon []byte
 
+// defaultTelemetryShutdownTimeout bounds how long Run waits for buffered traces/metrics to flush
+// to the OTLP collector on shutdown.
+const defaultTelemetryShutdownTimeout = 5 * time.Second
+
+// ipmiUsername is the IPMI username requested when rotating credentials, matching the one
+// service.ProviderServiceServer requests during provisioning.
+const ipmiUsername = "talos-agent"
+
 // Provider implements the bare metal infra provider.
 type Provider struct {
 	logger *zap.Logger
 
-	apiHost            string
-	imageFactoryPXEURL string
-	name               string
-	description        string
-	omniAPIEndpoint    string
+	imageFactoryPXEURL     string
+	imageFactoryBaseURL    string
+	ipxeBootMode           string
+	ipxeLocalAssetsDir     string
+	agentTalosVersion      string
+	otelEndpoint           string
+	otelProtocol           string
+	otelServiceName        string
+	adminToken             string
+	ipmiRotateSecretDir    string
+	ipmiRotateKeyFile      string
+	name                   string
+	description            string
+	omniAPIEndpoint        string
+	auditLogDir            string
+	bmcCredentialsDir      string
+	httpBootSigningKeyFile string
+	tlsCertFile            string
+	tlsKeyFile             string
+	tlsClientCAsFile       string
+
+	// apiHosts are the addresses the provider binds and advertises itself on - e.g. a management
+	// IPv4 address and a provisioning IPv6 address for a dual-stack deployment. The DHCP proxy
+	// advertises whichever of these matches the family (v4/v6) of the request it's answering, see
+	// dhcp.NewProxy.
+	apiHosts []string
 
 	apiPort        int
 	ipxeServerPort int
+	grpcPort       int
+
+	ipmiRotateInterval time.Duration
+	ipmiRotateJitter   time.Duration
 
 	insecureSkipTLSVerify bool
+	ipmiRotateDryRun      bool
 }
 
 // New creates a new Provider.
-func New(name, description, omniAPIEndpoint, imageFactoryPXEURL string, ipxeServerPort int, apiHost string, apiPort int, insecureSkipTLSVerify bool, logger *zap.Logger) *Provider {
+func New(
+	name, description, omniAPIEndpoint, imageFactoryPXEURL, imageFactoryBaseURL, ipxeBootMode, ipxeLocalAssetsDir, agentTalosVersion string,
+	otelEndpoint, otelProtocol, otelServiceName, adminToken string,
+	ipmiRotateInterval, ipmiRotateJitter time.Duration, ipmiRotateDryRun bool, ipmiRotateSecretDir, ipmiRotateKeyFile string,
+	ipxeServerPort int, apiHosts []string, apiPort int, insecureSkipTLSVerify bool,
+	auditLogDir, bmcCredentialsDir, httpBootSigningKeyFile string,
+	tlsCertFile, tlsKeyFile, tlsClientCAsFile string, grpcPort int, logger *zap.Logger,
+) *Provider {
 	return &Provider{
-		name:                  name,
-		description:           description,
-		omniAPIEndpoint:       omniAPIEndpoint,
-		imageFactoryPXEURL:    imageFactoryPXEURL,
-		ipxeServerPort:        ipxeServerPort,
-		apiHost:               apiHost,
-		apiPort:               apiPort,
-		insecureSkipTLSVerify: insecureSkipTLSVerify,
-		logger:                logger,
+		name:                   name,
+		description:            description,
+		omniAPIEndpoint:        omniAPIEndpoint,
+		imageFactoryPXEURL:     imageFactoryPXEURL,
+		imageFactoryBaseURL:    imageFactoryBaseURL,
+		ipxeBootMode:           ipxeBootMode,
+		ipxeLocalAssetsDir:     ipxeLocalAssetsDir,
+		agentTalosVersion:      agentTalosVersion,
+		otelEndpoint:           otelEndpoint,
+		otelProtocol:           otelProtocol,
+		otelServiceName:        otelServiceName,
+		adminToken:             adminToken,
+		ipmiRotateInterval:     ipmiRotateInterval,
+		ipmiRotateJitter:       ipmiRotateJitter,
+		ipmiRotateDryRun:       ipmiRotateDryRun,
+		ipmiRotateSecretDir:    ipmiRotateSecretDir,
+		ipmiRotateKeyFile:      ipmiRotateKeyFile,
+		ipxeServerPort:         ipxeServerPort,
+		apiHosts:               apiHosts,
+		apiPort:                apiPort,
+		insecureSkipTLSVerify:  insecureSkipTLSVerify,
+		auditLogDir:            auditLogDir,
+		bmcCredentialsDir:      bmcCredentialsDir,
+		httpBootSigningKeyFile: httpBootSigningKeyFile,
+		tlsCertFile:            tlsCertFile,
+		tlsKeyFile:             tlsKeyFile,
+		tlsClientCAsFile:       tlsClientCAsFile,
+		grpcPort:               grpcPort,
+		logger:                 logger,
 	}
 }
 
 // Run runs the provider.
 func (p *Provider) Run(ctx context.Context) error {
+	otelProtocol, err := p.buildOtelProtocol()
+	if err != nil {
+		return fmt.Errorf("invalid OpenTelemetry protocol: %w", err)
+	}
+
+	shutdownTelemetry, err := telemetry.Setup(ctx, telemetry.Config{
+		Endpoint:    p.otelEndpoint,
+		Protocol:    otelProtocol,
+		ServiceName: p.otelServiceName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up OpenTelemetry: %w", err)
+	}
+
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), defaultTelemetryShutdownTimeout)
+		defer cancel()
+
+		if shutdownErr := shutdownTelemetry(shutdownCtx); shutdownErr != nil {
+			p.logger.Warn("failed to shut down OpenTelemetry", zap.Error(shutdownErr))
+		}
+	}()
+
+	auditSink, err := p.buildAuditSink()
+	if err != nil {
+		return fmt.Errorf("failed to build audit sink: %w", err)
+	}
+
+	if closer, ok := auditSink.(audit.Closer); ok {
+		defer closer.Close() //nolint:errcheck
+	}
+
+	ctx = audit.WithSink(ctx, auditSink)
+
+	bmcCredentials, err := p.buildBMCCredentials()
+	if err != nil {
+		return fmt.Errorf("failed to build BMC credentials: %w", err)
+	}
+
+	httpBootSigningKey, err := p.buildHTTPBootSigningKey()
+	if err != nil {
+		return fmt.Errorf("failed to build HTTP boot signing key: %w", err)
+	}
+
 	omniClient, err := omni.BuildClient(p.omniAPIEndpoint, p.insecureSkipTLSVerify)
 	if err != nil {
 		return fmt.Errorf("failed to build omni client: %w", err)
@@ -69,21 +185,73 @@ func (p *Provider) Run(ctx context.Context) error {
 		return fmt.Errorf("failed to create/update provider status: %w", err)
 	}
 
-	ipxeHandler, err := ipxe.NewHandler(p.imageFactoryPXEURL, p.ipxeServerPort, p.logger.With(zap.String("component", "ipxe_handler")))
+	ipxeBootMode, err := ipxe.ParseMode(p.ipxeBootMode)
+	if err != nil {
+		return fmt.Errorf("invalid iPXE boot mode: %w", err)
+	}
+
+	var ipxeOpts []ipxe.Option
+	if p.ipxeLocalAssetsDir != "" {
+		ipxeOpts = append(ipxeOpts, ipxe.WithLocalAssetsDir(p.ipxeLocalAssetsDir))
+	}
+
+	// todo: the patched iPXE chain script only embeds the first advertised host - a machine that
+	// only has a route to a later --api-host won't be able to chain back. Patching one binary per
+	// host (so the right one can be handed out per DHCP family) is follow-up work.
+	ipxeHandler, err := ipxe.NewHandler(ctx, ipxeBootMode, p.apiHosts[0], p.apiPort, p.imageFactoryPXEURL, p.imageFactoryBaseURL, p.agentTalosVersion, omniClient,
+		p.logger.With(zap.String("component", "ipxe_handler")), ipxeOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to create iPXE handler: %w", err)
 	}
 
+	var httpBootOpts []httpboot.Option
+	if httpBootSigningKey != nil {
+		httpBootOpts = append(httpBootOpts, httpboot.WithSigningKey(httpBootSigningKey))
+	}
+
+	httpBootHandler := httpboot.NewHandler(constants.TFTPPath, p.logger.With(zap.String("component", "httpboot_handler")), httpBootOpts...)
+
 	configHandler, err := config.NewHandler(ctx, omniClient, p.logger.With(zap.String("component", "config_handler")))
 	if err != nil {
 		return fmt.Errorf("failed to create config handler: %w", err)
 	}
 
-	srvr := server.New(p.apiHost, p.apiPort, configHandler, ipxeHandler, p.logger.With(zap.String("component", "server")))
+	serverOpts := []server.Option{
+		server.WithUnaryInterceptors(metrics.UnaryServerInterceptor()),
+		server.WithLocalAssetsHandler(ipxeHandler.LocalAssetsHandler()),
+	}
+
+	if p.tlsCertFile != "" {
+		serverOpts = append(serverOpts, server.WithTLS(p.tlsCertFile, p.tlsKeyFile, p.tlsClientCAsFile))
+	}
+
+	if p.grpcPort != 0 {
+		serverOpts = append(serverOpts, server.WithSeparateGRPCPort(p.grpcPort))
+	}
+
+	srvr, err := server.New(p.apiHosts, p.apiPort, configHandler, ipxeHandler, httpBootHandler, ipxeHandler.ManifestHandler(),
+		p.logger.With(zap.String("component", "server")), serverOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+
 	agentController := agent.NewController(srvr, p.logger.With(zap.String("component", "controller")))
-	dhcpProxy := dhcp.NewProxy(p.apiHost, p.apiPort, p.logger.With(zap.String("component", "dhcp_proxy")))
+
+	// The admin API needs agentController, which in turn needs srvr to register against, so it
+	// can only be mounted after srvr exists - see server.Server.Handle.
+	if p.adminToken != "" {
+		adminHandler := admin.NewHandler(p.adminToken, agentController, omniClient, bmcCredentials, p.logger.With(zap.String("component", "admin_handler")))
+		srvr.Handle("/admin/", adminHandler)
+	}
+
+	dhcpProxy := dhcp.NewProxy(p.apiHosts, p.apiPort, httpBootSigningKey, p.logger.With(zap.String("component", "dhcp_proxy")))
 	tftpServer := tftp.NewServer(p.logger.With(zap.String("component", "tftp_server")))
 
+	rotator, err := p.buildIPMIRotator(agentController, omniClient, bmcCredentials)
+	if err != nil {
+		return fmt.Errorf("failed to build IPMI credential rotator: %w", err)
+	}
+
 	eg, ctx := errgroup.WithContext(ctx)
 
 	eg.Go(p.runComponent("server", func() error {
@@ -91,7 +259,7 @@ func (p *Provider) Run(ctx context.Context) error {
 	}))
 
 	eg.Go(p.runComponent("reverse tunnel", func() error {
-		return omniClient.RunReverseTunnel(ctx, agentController, p.logger.With(zap.String("component", "reverse_tunnel")))
+		return omniClient.RunReverseTunnel(ctx, agentController, bmcCredentials, p.logger.With(zap.String("component", "reverse_tunnel")))
 	}))
 
 	eg.Go(p.runComponent("DHCP proxy", func() error {
@@ -102,6 +270,12 @@ func (p *Provider) Run(ctx context.Context) error {
 		return tftpServer.Run(ctx)
 	}))
 
+	if rotator != nil {
+		eg.Go(p.runComponent("IPMI credential rotator", func() error {
+			return rotator.Run(ctx)
+		}))
+	}
+
 	if err = eg.Wait(); err != nil {
 		return fmt.Errorf("failed to run provider: %w", err)
 	}
@@ -125,3 +299,87 @@ func (p *Provider) runComponent(name string, f func() error) func() error {
 		return nil
 	}
 }
+
+// buildAuditSink builds the audit.Sink to use for this run.
+//
+// If no audit log directory is configured, audit records are discarded.
+func (p *Provider) buildAuditSink() (audit.Sink, error) {
+	if p.auditLogDir == "" {
+		return audit.NopSink{}, nil
+	}
+
+	sink, err := audit.NewFileSink(p.auditLogDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// buildOtelProtocol parses the OTLP protocol flag, defaulting to telemetry.ProtocolGRPC if unset.
+func (p *Provider) buildOtelProtocol() (telemetry.Protocol, error) {
+	if p.otelProtocol == "" {
+		return telemetry.ProtocolGRPC, nil
+	}
+
+	return telemetry.ParseProtocol(p.otelProtocol)
+}
+
+// buildBMCCredentials reads the shared BMC credentials to use for all machines, overriding the
+// per-machine credentials persisted on the resource.
+//
+// If no credentials directory is configured, a zero Credentials is returned, and the service
+// falls back to the per-machine credentials.
+func (p *Provider) buildBMCCredentials() (power.Credentials, error) {
+	if p.bmcCredentialsDir == "" {
+		return power.Credentials{}, nil
+	}
+
+	return power.ReadCredentialsDir(p.bmcCredentialsDir)
+}
+
+// buildIPMIRotator builds the ipmirotate.Rotator that periodically rotates IPMI credentials.
+//
+// If no rotation interval is configured, rotation is disabled and a nil Rotator is returned.
+func (p *Provider) buildIPMIRotator(agentController ipmirotate.AgentController, omniClient ipmirotate.OmniClient,
+	bmcCredentials power.Credentials,
+) (*ipmirotate.Rotator, error) {
+	if p.ipmiRotateInterval <= 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	key, err := os.ReadFile(p.ipmiRotateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IPMI rotate secret store key file: %w", err)
+	}
+
+	secretStore, err := ipmirotate.NewFileStore(p.ipmiRotateSecretDir, bytes.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IPMI rotate secret store: %w", err)
+	}
+
+	return ipmirotate.NewRotator(agentController, omniClient, secretStore, ipmirotate.Config{
+		Interval: p.ipmiRotateInterval,
+		Jitter:   p.ipmiRotateJitter,
+		DryRun:   p.ipmiRotateDryRun,
+		Username: ipmiUsername,
+	}, p.logger.With(zap.String("component", "ipmi_rotator"))), nil
+}
+
+// buildHTTPBootSigningKey reads the secret used to sign UEFI HTTP Boot URLs handed out in DHCP
+// offers.
+//
+// If no signing key file is configured, a nil key is returned, and HTTP boot artifacts are served
+// unauthenticated.
+func (p *Provider) buildHTTPBootSigningKey() ([]byte, error) {
+	if p.httpBootSigningKeyFile == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	key, err := os.ReadFile(p.httpBootSigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP boot signing key file: %w", err)
+	}
+
+	return bytes.TrimSpace(key), nil
+}
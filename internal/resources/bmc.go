@@ -0,0 +1,36 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package resources
+
+import "github.com/siderolabs/omni-infra-provider-bare-metal/internal/power"
+
+// BMCSpec describes how to reach a machine's BMC.
+//
+// todo: this mirrors fields that belong on specs.MachineSpec (address, credentials-secret-ref,
+// driver type, verify-tls) so that they are persisted alongside the machine. specs.MachineSpec is
+// generated from the provider's protobuf API definitions, which live outside this module
+// (api/specs) - until that proto grows a BmcProtocol enum and RedfishURL/TLS trust-bundle fields,
+// BMCSpec is derived from the fields already present on specs.MachineSpec (IpmiIp/IpmiPort) and
+// leaves Driver unset: callers probe the real protocol via power.ProbeDriver against Address on
+// every call instead of trusting a persisted value, since there is nowhere to persist it yet.
+type BMCSpec struct {
+	Address   string
+	Port      int
+	Driver    power.DriverType
+	VerifyTLS bool
+}
+
+// BMCSpecFromMachine derives a BMCSpec from the machine's persisted spec.
+//
+// Credentials are intentionally not included here - they are read from a secret file mounted into
+// the provider rather than stored on the resource, see power.ReadCredentialsDir.
+func BMCSpecFromMachine(machine *Machine) BMCSpec {
+	spec := machine.TypedSpec().Value
+
+	return BMCSpec{
+		Address: spec.IpmiIp,
+		Port:    int(spec.IpmiPort),
+	}
+}
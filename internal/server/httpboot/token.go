@@ -0,0 +1,74 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package httpboot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Query parameters carrying a signed token, see SignURL.
+const (
+	queryParamUUID      = "uuid"
+	queryParamExpiry    = "exp"
+	queryParamSignature = "sig"
+)
+
+// SignURL returns the query string to append to path (relative to a Handler's baseDir) that
+// authorizes the machine identified by uuid to fetch it until expiry.
+func SignURL(secret []byte, path, uuid string, expiry time.Time) string {
+	expUnix := strconv.FormatInt(expiry.Unix(), 10)
+
+	values := url.Values{}
+	values.Set(queryParamUUID, uuid)
+	values.Set(queryParamExpiry, expUnix)
+	values.Set(queryParamSignature, sign(secret, path, uuid, expUnix))
+
+	return values.Encode()
+}
+
+// verifyToken verifies the signed token carried by query against path.
+func verifyToken(secret []byte, path string, query url.Values) error {
+	expRaw := query.Get(queryParamExpiry)
+	sig := query.Get(queryParamSignature)
+
+	if expRaw == "" || sig == "" {
+		return fmt.Errorf("missing signed token")
+	}
+
+	expUnix, err := strconv.ParseInt(expRaw, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid token expiry: %w", err)
+	}
+
+	if time.Now().Unix() > expUnix {
+		return fmt.Errorf("token expired")
+	}
+
+	uuid := query.Get(queryParamUUID)
+
+	expected := sign(secret, path, uuid, expRaw)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return fmt.Errorf("invalid token signature")
+	}
+
+	return nil
+}
+
+func sign(secret []byte, path, uuid, expUnix string) string {
+	mac := hmac.New(sha256.New, secret)
+
+	for _, part := range []string{path, uuid, expUnix} {
+		mac.Write([]byte(part)) //nolint:errcheck
+		mac.Write([]byte("|"))  //nolint:errcheck
+	}
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
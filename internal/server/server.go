@@ -7,29 +7,51 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.uber.org/zap"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
+
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/metrics"
 )
 
+// defaultShutdownTimeout is how long Run waits for in-flight requests to finish during a graceful
+// shutdown before forcibly stopping the servers, unless overridden via WithShutdownTimeout.
+const defaultShutdownTimeout = 5 * time.Second
+
 // Server represents the HTTP and GRPC servers.
 type Server struct {
 	grpcServer *grpc.Server
-	httpServer *http.Server
+
+	// httpServers holds one *http.Server per advertised endpoint, all sharing the same handler,
+	// so the provider can be reached on several interfaces at once - see New.
+	httpServers []*http.Server
+	httpMux     *http.ServeMux
+
+	// grpcAddrs is non-empty when the GRPC server listens on its own port instead of being
+	// multiplexed onto httpServers, see WithSeparateGRPCPort - one address per endpoint.
+	grpcAddrs []string
+
+	shutdownTimeout time.Duration
 }
 
 // RegisterService registers a service with the GRPC server.
@@ -39,67 +61,287 @@ func (s *Server) RegisterService(desc *grpc.ServiceDesc, impl any) {
 	s.grpcServer.RegisterService(desc, impl)
 }
 
-// New creates a new server.
-func New(endpoint string, port int, configHandler, ipxeHandler http.Handler, logger *zap.Logger) *Server {
+// Handle registers an additional HTTP handler on the server's HTTP mux under pattern, after
+// construction.
+//
+// This exists for handlers such as the admin API, which depend on an agent.Controller that in
+// turn needs a grpc.ServiceRegistrar to register against - so they can only be built from a
+// *Server returned by New, not passed into it as an Option.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.httpMux.Handle(pattern, handler)
+}
+
+// config holds the options accumulated by Option.
+type config struct {
+	certFile      string
+	keyFile       string
+	clientCAsFile string
+
+	grpcPort int
+
+	shutdownTimeout time.Duration
+
+	unaryInterceptors []grpc.UnaryServerInterceptor
+
+	localAssetsHandler http.Handler
+}
+
+// Option configures a Server.
+type Option func(*config)
+
+// WithTLS terminates TLS on the server itself, using the certificate and key at certFile and
+// keyFile, instead of relying on an ingress/load balancer to do so.
+//
+// If clientCAsFile is set, it must point at a PEM bundle of CA certificates: client certificates
+// are then required and verified against it (mTLS).
+func WithTLS(certFile, keyFile, clientCAsFile string) Option {
+	return func(c *config) {
+		c.certFile = certFile
+		c.keyFile = keyFile
+		c.clientCAsFile = clientCAsFile
+	}
+}
+
+// WithSeparateGRPCPort binds the GRPC server on its own port instead of multiplexing it with the
+// HTTP server over h2c.
+func WithSeparateGRPCPort(port int) Option {
+	return func(c *config) {
+		c.grpcPort = port
+	}
+}
+
+// WithLocalAssetsHandler mounts handler at "/ipxe/local/", serving the kernel/initramfs the iPXE
+// handler hands out in its "local" boot mode. Only set when that handler runs in local mode.
+func WithLocalAssetsHandler(handler http.Handler) Option {
+	return func(c *config) {
+		c.localAssetsHandler = handler
+	}
+}
+
+// WithShutdownTimeout overrides how long Run waits for in-flight requests to finish during a
+// graceful shutdown before forcibly stopping the servers. Defaults to defaultShutdownTimeout.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.shutdownTimeout = timeout
+	}
+}
+
+// WithUnaryInterceptors chains the given unary server interceptors onto the GRPC server, after
+// the built-in panic-recovery interceptor.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(c *config) {
+		c.unaryInterceptors = append(c.unaryInterceptors, interceptors...)
+	}
+}
+
+// New creates a new server, listening on every one of endpoints (e.g. a management IPv4 address
+// and a provisioning IPv6 address), so machines on different L2 segments can reach it without an
+// external load balancer.
+func New(endpoints []string, port int, configHandler, ipxeHandler, httpBootHandler, manifestHandler http.Handler, logger *zap.Logger, opts ...Option) (*Server, error) {
+	cfg := config{shutdownTimeout: defaultShutdownTimeout}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	tlsConfig, err := buildTLSConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build TLS config: %w", err)
+	}
+
 	recoveryOption := recovery.WithRecoveryHandler(recoveryHandler(logger))
 
-	grpcServer := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(recovery.UnaryServerInterceptor(recoveryOption)),
+	unaryInterceptors := append([]grpc.UnaryServerInterceptor{recovery.UnaryServerInterceptor(recoveryOption)}, cfg.unaryInterceptors...)
+
+	grpcServerOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
 		grpc.ChainStreamInterceptor(recovery.StreamServerInterceptor(recoveryOption)),
-		grpc.Creds(insecure.NewCredentials()),
+		// Instruments every RPC - including the reverse-tunnel stream itself - against the
+		// globally configured OpenTelemetry TracerProvider/MeterProvider. A no-op until
+		// telemetry.Setup installs real ones.
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+	}
+
+	if tlsConfig != nil {
+		grpcServerOpts = append(grpcServerOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else {
+		grpcServerOpts = append(grpcServerOpts, grpc.Creds(insecure.NewCredentials()))
+	}
+
+	grpcServer := grpc.NewServer(grpcServerOpts...)
+
+	httpMux := http.NewServeMux()
+	httpMux.Handle("/config", configHandler)
+	httpMux.Handle("/ipxe", otelhttp.NewHandler(ipxeHandler, "ipxe"))
+	httpMux.Handle("/ipxe/manifest", manifestHandler)
+	httpMux.Handle("/tftp/", http.StripPrefix("/tftp/", httpBootHandler))
+	httpMux.Handle("/assets/", http.StripPrefix("/assets/", httpBootHandler))
+	httpMux.Handle("/metrics", metrics.Handler())
+
+	if cfg.localAssetsHandler != nil {
+		httpMux.Handle("/ipxe/local/", http.StripPrefix("/ipxe/local/", cfg.localAssetsHandler))
+	}
+
+	var (
+		httpHandler http.Handler = httpMux
+		grpcAddrs   []string
 	)
 
-	httpServer := &http.Server{
-		Addr:    net.JoinHostPort(endpoint, strconv.Itoa(port)),
-		Handler: newMultiHandler(configHandler, ipxeHandler, grpcServer),
+	if cfg.grpcPort != 0 {
+		// The GRPC server listens on its own port below, so the HTTP server only ever needs to
+		// serve plain HTTP(S) requests.
+		for _, endpoint := range endpoints {
+			grpcAddrs = append(grpcAddrs, net.JoinHostPort(endpoint, strconv.Itoa(cfg.grpcPort)))
+		}
+	} else if tlsConfig == nil {
+		// No TLS and no separate GRPC port: multiplex GRPC onto the HTTP server over h2c, as
+		// ALPN-based protocol negotiation isn't available without TLS.
+		httpHandler = h2c.NewHandler(&multiHandler{httpHandler: httpMux, grpcHandler: grpcServer}, &http2.Server{})
+	} else {
+		// TLS and no separate GRPC port: multiplex GRPC onto the HTTP server using standard
+		// ALPN-negotiated HTTP/2, which net/http enables automatically for TLS listeners.
+		httpHandler = &multiHandler{httpHandler: httpMux, grpcHandler: grpcServer}
+	}
+
+	httpServers := make([]*http.Server, 0, len(endpoints))
+
+	for _, endpoint := range endpoints {
+		httpServers = append(httpServers, &http.Server{
+			Addr:      net.JoinHostPort(endpoint, strconv.Itoa(port)),
+			Handler:   httpHandler,
+			TLSConfig: tlsConfig,
+		})
 	}
 
 	return &Server{
-		grpcServer: grpcServer,
-		httpServer: httpServer,
+		grpcServer:      grpcServer,
+		httpServers:     httpServers,
+		httpMux:         httpMux,
+		grpcAddrs:       grpcAddrs,
+		shutdownTimeout: cfg.shutdownTimeout,
+	}, nil
+}
+
+// buildTLSConfig loads the TLS certificate/client CA bundle configured via WithTLS, returning nil
+// if TLS wasn't configured.
+func buildTLSConfig(cfg config) (*tls.Config, error) {
+	if cfg.certFile == "" {
+		return nil, nil //nolint:nilnil
 	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.certFile, cfg.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.clientCAsFile == "" {
+		return tlsConfig, nil
+	}
+
+	caBundle, err := os.ReadFile(cfg.clientCAsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caBundle) {
+		return nil, errors.New("failed to parse client CA bundle")
+	}
+
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return tlsConfig, nil
 }
 
-// Run runs the server.
+// Run runs the server until ctx is done, then gives in-flight requests up to shutdownTimeout to
+// finish gracefully before forcibly stopping.
 func (s *Server) Run(ctx context.Context) error {
 	eg, ctx := errgroup.WithContext(ctx)
 
 	eg.Go(func() error {
 		<-ctx.Done()
 
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 		defer cancel()
 
-		if err := s.httpServer.Shutdown(shutdownCtx); err != nil { //nolint:contextcheck
-			return fmt.Errorf("failed to shutdown iPXE server: %w", err)
-		}
-
-		return nil
+		return s.shutdown(shutdownCtx) //nolint:contextcheck
 	})
 
-	eg.Go(func() error {
-		if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			return fmt.Errorf("failed to run server: %w", err)
-		}
+	for _, httpServer := range s.httpServers {
+		eg.Go(func() error {
+			var err error
+			if httpServer.TLSConfig != nil {
+				err = httpServer.ListenAndServeTLS("", "")
+			} else {
+				err = httpServer.ListenAndServe()
+			}
 
-		return nil
-	})
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("failed to run HTTP server on %q: %w", httpServer.Addr, err)
+			}
+
+			return nil
+		})
+	}
+
+	// grpc.Server.Serve can be called concurrently with a distinct net.Listener per advertised
+	// endpoint; every call serves the same *grpc.Server.
+	for _, grpcAddr := range s.grpcAddrs {
+		eg.Go(func() error {
+			lis, err := net.Listen("tcp", grpcAddr)
+			if err != nil {
+				return fmt.Errorf("failed to listen on GRPC address %q: %w", grpcAddr, err)
+			}
+
+			if err = s.grpcServer.Serve(lis); err != nil {
+				return fmt.Errorf("failed to run GRPC server on %q: %w", grpcAddr, err)
+			}
+
+			return nil
+		})
+	}
 
 	return eg.Wait()
 }
 
-func newMultiHandler(configHandler, ipxeHandler http.Handler, grpcHandler http.Handler) http.Handler {
-	mux := http.NewServeMux()
+// shutdown gracefully stops the HTTP and GRPC servers in parallel, forcibly stopping the GRPC
+// server if it hasn't finished by the time ctx is done.
+func (s *Server) shutdown(ctx context.Context) error {
+	var eg errgroup.Group
 
-	mux.Handle("/config", configHandler)
-	mux.Handle("/ipxe", ipxeHandler)
+	for _, httpServer := range s.httpServers {
+		eg.Go(func() error {
+			if err := httpServer.Shutdown(ctx); err != nil {
+				return fmt.Errorf("failed to shutdown HTTP server on %q: %w", httpServer.Addr, err)
+			}
 
-	multi := &multiHandler{
-		httpHandler: mux,
-		grpcHandler: grpcHandler,
+			return nil
+		})
 	}
 
-	return h2c.NewHandler(multi, &http2.Server{})
+	eg.Go(func() error {
+		stopped := make(chan struct{})
+
+		go func() {
+			s.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.grpcServer.Stop()
+		}
+
+		return nil
+	})
+
+	return eg.Wait()
 }
 
 type multiHandler struct {
@@ -8,11 +8,13 @@ package service
 import (
 	"context"
 
-	goipmi "github.com/pensando/goipmi"
 	"go.uber.org/zap"
 
 	"github.com/siderolabs/omni-infra-provider-bare-metal/api/provider"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/api/specs"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/audit"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/metrics"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/power"
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/resources"
 )
 
@@ -38,27 +40,43 @@ type ProviderServiceServer struct {
 	logger          *zap.Logger
 	agentController AgentController
 	omniClient      OmniClient
+
+	// bmcCredentials, when set, overrides the per-machine IPMI password with a shared credential
+	// read from a secret file mounted into the provider, rather than the one persisted on the
+	// resource.
+	bmcCredentials power.Credentials
 }
 
 // NewProviderServiceServer creates a new ProviderServiceServer.
-func NewProviderServiceServer(agentController AgentController, omniClient OmniClient, logger *zap.Logger) *ProviderServiceServer {
+func NewProviderServiceServer(agentController AgentController, omniClient OmniClient, bmcCredentials power.Credentials, logger *zap.Logger) *ProviderServiceServer {
 	return &ProviderServiceServer{
 		agentController: agentController,
 		omniClient:      omniClient,
+		bmcCredentials:  bmcCredentials,
 		logger:          logger,
 	}
 }
 
 // ProvisionMachine provisions a machine.
-func (p *ProviderServiceServer) ProvisionMachine(ctx context.Context, request *providerpb.ProvisionMachineRequest) (*providerpb.ProvisionMachineResponse, error) {
+func (p *ProviderServiceServer) ProvisionMachine(ctx context.Context, request *providerpb.ProvisionMachineRequest) (resp *providerpb.ProvisionMachineResponse, err error) {
 	p.logger.Info("provision machine", zap.String("machine_id", request.Id))
 
+	defer func() {
+		metrics.ProvisionTotal.WithLabelValues(metrics.ResultLabel(err)).Inc()
+	}()
+
 	password, err := p.agentController.SetIPMICredentials(ctx, request.Id, ipmiUsername)
+
+	audit.Write(ctx, audit.ActionIPMICredentials, request.Id, audit.ResultFromErr(err), "", "", err)
+
 	if err != nil {
 		return nil, err
 	}
 
 	ipmiIP, ipmiPort, err := p.agentController.GetIPMIInfo(ctx, request.Id)
+
+	audit.Write(ctx, audit.ActionGetIPMIInfo, request.Id, audit.ResultFromErr(err), "", "", err)
+
 	if err != nil {
 		return nil, err
 	}
@@ -74,9 +92,11 @@ func (p *ProviderServiceServer) ProvisionMachine(ctx context.Context, request *p
 		return nil, err
 	}
 
-	if err = withClient(machine, func(client *goipmi.Client) error {
-		return client.Control(goipmi.ControlPowerUp)
-	}); err != nil {
+	err = p.powerManagerFor(ctx, machine).On(ctx)
+
+	audit.Write(ctx, audit.ActionPowerOn, request.Id, audit.ResultFromErr(err), "", "", err)
+
+	if err != nil {
 		return nil, err
 	}
 
@@ -84,22 +104,30 @@ func (p *ProviderServiceServer) ProvisionMachine(ctx context.Context, request *p
 }
 
 // DeprovisionMachine deprovisions a machine.
-func (p *ProviderServiceServer) DeprovisionMachine(ctx context.Context, request *providerpb.DeprovisionMachineRequest) (*providerpb.DeprovisionMachineResponse, error) {
+func (p *ProviderServiceServer) DeprovisionMachine(ctx context.Context, request *providerpb.DeprovisionMachineRequest) (resp *providerpb.DeprovisionMachineResponse, err error) {
 	p.logger.Info("deprovision machine", zap.String("machine_id", request.Id))
 
+	defer func() {
+		metrics.DeprovisionTotal.WithLabelValues(metrics.ResultLabel(err)).Inc()
+	}()
+
 	machine, err := p.omniClient.GetMachine(ctx, request.Id)
 	if err != nil {
 		return nil, err
 	}
 
+	powerManager := p.powerManagerFor(ctx, machine)
+
 	// remove the machine resource, then reboot, so we boot back into the agent mode
 	if err = p.omniClient.RemoveMachine(ctx, request.Id); err != nil {
 		return nil, err
 	}
 
-	if err = withClient(machine, func(client *goipmi.Client) error {
-		return client.Control(goipmi.ControlPowerCycle)
-	}); err != nil {
+	err = powerManager.Cycle(ctx)
+
+	audit.Write(ctx, audit.ActionPowerCycle, request.Id, audit.ResultFromErr(err), "", "", err)
+
+	if err != nil {
 		return nil, err
 	}
 
@@ -115,30 +143,51 @@ func (p *ProviderServiceServer) PowerOnMachine(ctx context.Context, request *pro
 		return nil, err
 	}
 
-	if err = withClient(machine, func(client *goipmi.Client) error {
-		return client.Control(goipmi.ControlPowerUp)
-	}); err != nil {
+	err = p.powerManagerFor(ctx, machine).On(ctx)
+
+	audit.Write(ctx, audit.ActionPowerOn, request.Id, audit.ResultFromErr(err), "", "", err)
+
+	if err != nil {
 		return nil, err
 	}
 
 	return &providerpb.PowerOnMachineResponse{}, nil
 }
 
-func withClient(machine *resources.Machine, f func(client *goipmi.Client) error) error {
-	conn := &goipmi.Connection{
-		Hostname:  machine.TypedSpec().Value.IpmiIp,
-		Port:      int(machine.TypedSpec().Value.IpmiPort),
-		Username:  ipmiUsername,
-		Password:  machine.TypedSpec().Value.IpmiPassword,
-		Interface: "lanplus",
+// powerManagerFor builds the power.Manager to use for the given machine's BMC, probing which
+// protocol it actually speaks since the driver isn't persisted on resources.Machine yet - see the
+// todo on resources.BMCSpec.
+func (p *ProviderServiceServer) powerManagerFor(ctx context.Context, machine *resources.Machine) power.Manager {
+	bmcSpec := resources.BMCSpecFromMachine(machine)
+
+	driver := power.ProbeDriver(ctx, bmcSpec.Address, bmcSpec.VerifyTLS)
+
+	p.logger.Info("probed BMC protocol", zap.String("machine_id", machine.Metadata().ID()), zap.String("driver", string(driver)))
+
+	address := bmcSpec.Address
+	if driver == power.DriverRedfish {
+		address = "https://" + bmcSpec.Address
 	}
 
-	client, err := goipmi.NewClient(conn)
-	if err != nil {
-		return err
+	username := ipmiUsername
+	password := machine.TypedSpec().Value.IpmiPassword
+
+	if p.bmcCredentials.Username != "" {
+		username = p.bmcCredentials.Username
+		password = p.bmcCredentials.Password
 	}
 
-	defer client.Close() //nolint:errcheck
+	manager, err := power.New(power.Config{
+		Driver:   driver,
+		Address:  address,
+		Port:     bmcSpec.Port,
+		Username: username,
+		Password: password,
+	})
+	if err != nil {
+		// driver comes from power.ProbeDriver, which only ever returns power.New-supported types.
+		panic(err)
+	}
 
-	return f(client)
+	return manager
 }
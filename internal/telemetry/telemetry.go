@@ -0,0 +1,124 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package telemetry configures OpenTelemetry trace and metric export for the provider.
+//
+// Unlike the Prometheus counters in internal/metrics, which are scraped and therefore need to
+// stay low-cardinality, traces exported here can carry per-request attributes (e.g. a machine
+// UUID) without blowing up a time series, which is what makes the reverse-tunnel RPC path and the
+// iPXE boot flow debuggable at scale.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Protocol selects the wire protocol used to reach the OTLP endpoint.
+type Protocol string
+
+// Known Protocols.
+const (
+	ProtocolGRPC Protocol = "grpc"
+	ProtocolHTTP Protocol = "http"
+)
+
+// ParseProtocol validates and converts s into a Protocol, for use with the --otel-protocol flag.
+func ParseProtocol(s string) (Protocol, error) {
+	switch protocol := Protocol(s); protocol {
+	case ProtocolGRPC, ProtocolHTTP:
+		return protocol, nil
+	default:
+		return "", fmt.Errorf("invalid OTLP protocol %q, must be one of: %q, %q", s, ProtocolGRPC, ProtocolHTTP)
+	}
+}
+
+// Config configures Setup.
+type Config struct {
+	// Endpoint is the "host:port" of the OTLP collector. If empty, Setup leaves the global
+	// providers at their OpenTelemetry-default no-ops and returns a no-op shutdown func.
+	Endpoint string
+
+	// Protocol is the OTLP wire protocol to speak to Endpoint, either ProtocolGRPC or
+	// ProtocolHTTP.
+	Protocol Protocol
+
+	// ServiceName is reported as the "service.name" resource attribute on every exported trace
+	// and metric.
+	ServiceName string
+}
+
+// Setup configures the global TracerProvider and MeterProvider to export to cfg.Endpoint over
+// OTLP, returning a func that flushes and shuts both down.
+//
+// If cfg.Endpoint is empty, telemetry is left disabled: the global providers stay at their
+// OpenTelemetry-default no-ops, so instrumentation elsewhere in the provider (otelgrpc, otelhttp,
+// the tracer/meter in internal/agent) never needs to nil-check.
+func Setup(ctx context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenTelemetry resource: %w", err)
+	}
+
+	traceExporter, err := newTraceExporter(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OTLP trace exporter: %w", err)
+	}
+
+	metricExporter, err := newMetricExporter(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OTLP metric exporter: %w", err)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(traceExporter), sdktrace.WithResource(res))
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)), sdkmetric.WithResource(res))
+
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(shutdownCtx context.Context) error {
+		return errors.Join(tracerProvider.Shutdown(shutdownCtx), meterProvider.Shutdown(shutdownCtx))
+	}, nil
+}
+
+// newTraceExporter builds the OTLP trace exporter for cfg.Protocol.
+func newTraceExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Protocol {
+	case ProtocolGRPC, "":
+		return otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(cfg.Endpoint), otlptracegrpc.WithInsecure())
+	case ProtocolHTTP:
+		return otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(cfg.Endpoint), otlptracehttp.WithInsecure())
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", cfg.Protocol)
+	}
+}
+
+// newMetricExporter builds the OTLP metric exporter for cfg.Protocol.
+func newMetricExporter(ctx context.Context, cfg Config) (sdkmetric.Exporter, error) {
+	switch cfg.Protocol {
+	case ProtocolGRPC, "":
+		return otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpoint(cfg.Endpoint), otlpmetricgrpc.WithInsecure())
+	case ProtocolHTTP:
+		return otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpoint(cfg.Endpoint), otlpmetrichttp.WithInsecure())
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", cfg.Protocol)
+	}
+}
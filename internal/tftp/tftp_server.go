@@ -17,6 +17,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/constants"
+	"github.com/siderolabs/omni-infra-provider-bare-metal/internal/metrics"
 )
 
 // Server represents the TFTP server serving iPXE binaries.
@@ -118,6 +119,8 @@ func handleRead(filename string, rf io.ReaderFrom, logger *zap.Logger) error {
 		return err
 	}
 
+	metrics.TFTPFilesServedTotal.Inc()
+
 	logger.Info("file sent", zap.String("filename", filename), zap.Int64("bytes", n))
 
 	return nil